@@ -0,0 +1,494 @@
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	chartFile             = "Chart.yaml"
+	chartValuesFile       = "values.yaml"
+	chartValuesSchemaFile = "values.schema.json"
+)
+
+// chartDependency represents a chart dependency as declared in Chart.yaml
+type chartDependency struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias,omitempty"`
+}
+
+// loadValues reads the default values and the values schema of a local chart, a directory or a packaged chart.
+// Other charts are read by pullChartInfo.
+func (c *ChartInfo) loadValues(chart string) error {
+	var files map[string][]byte
+
+	fi, err := os.Stat(chart)
+	switch {
+	case err != nil:
+		return err
+	case fi.IsDir():
+		files = make(map[string][]byte)
+		for _, name := range []string{chartValuesFile, chartValuesSchemaFile} {
+			data, err := ioutil.ReadFile(filepath.Join(chart, name))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+			files[name] = data
+		}
+	default:
+		if files, err = readChartArchive(chart); err != nil {
+			return err
+		}
+	}
+	return c.setValues(chart, files)
+}
+
+// pullChartInfo pulls a chart package once into the helmsman temp directory and reads
+// its Chart.yaml, default values and values schema from it
+func pullChartInfo(chart, version string) (*ChartInfo, error) {
+	archive, err := pullChartArchive(chart, version)
+	if err != nil {
+		maybeRepo := filepath.Base(filepath.Dir(chart))
+		return nil, fmt.Errorf("chart [ %s ] version [ %s ] can't be found. If this is not a local chart, add the repo [ %s ] in your helmRepos stanza. Error output: %w", chart, version, maybeRepo, err)
+	}
+	files, err := readChartArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	c := &ChartInfo{}
+	if err := yaml.Unmarshal(files[chartFile], c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s of chart [ %s ]: %w", chartFile, chart, err)
+	}
+	if err := c.matchVersion(chart, version); err != nil {
+		return nil, err
+	}
+	if err := c.setValues(chart, files); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// setValues sets the default values and the values schema of a chart from the files read from it
+func (c *ChartInfo) setValues(chart string, files map[string][]byte) error {
+	c.values = make(map[string]interface{})
+	if data, ok := files[chartValuesFile]; ok {
+		if err := yaml.Unmarshal(data, &c.values); err != nil {
+			return fmt.Errorf("failed to parse %s of chart [ %s ]: %w", chartValuesFile, chart, err)
+		}
+		if c.values == nil {
+			c.values = make(map[string]interface{})
+		}
+	}
+	c.schema = files[chartValuesSchemaFile]
+	return nil
+}
+
+// pullChartArchive pulls a chart package into the helmsman temp directory and returns its path
+func pullChartArchive(chart, version string) (string, error) {
+	dest := createTempDir(tempFilesDir, "chart")
+	args := []string{"pull", chart, "-d", dest}
+	if version != "" && version != "latest" {
+		args = append(args, "--version", version)
+	}
+	cmd := helmCmd(args, "Pulling chart [ "+chart+" ] version [ "+version+" ] to inspect its values")
+	if _, err := cmd.Exec(); err != nil {
+		return "", err
+	}
+	archives, err := filepath.Glob(filepath.Join(dest, "*.tgz"))
+	if err != nil || len(archives) == 0 {
+		return "", fmt.Errorf("no chart package found after pulling [ %s ]", chart)
+	}
+	return archives[0], nil
+}
+
+// readChartArchive extracts the top level Chart.yaml, values.yaml and values.schema.json files from a packaged chart
+func readChartArchive(archive string) (map[string][]byte, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chart package %s: %w", archive, err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart package %s: %w", archive, err)
+		}
+		parts := strings.Split(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if len(parts) != 2 || (parts[1] != chartFile && parts[1] != chartValuesFile && parts[1] != chartValuesSchemaFile) {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[parts[1]] = data
+	}
+	return files, nil
+}
+
+// getMergedValues merges the release values in the same order they are passed to helm:
+// values files first, then inline values, secrets files, set, setString and setFile.
+// Secrets files are decrypted like when they are passed to helm, each of them is decrypted once per run.
+func (r *Release) getMergedValues() (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	var files []string
+	if r.ValuesFile != "" {
+		files = append(files, r.ValuesFile)
+	} else {
+		files = append(files, r.ValuesFiles...)
+	}
+	if err := mergeValuesFiles(values, files); err != nil {
+		return nil, err
+	}
+	mergeValues(values, copyValues(r.Values))
+
+	secretsFiles := r.getSecretsFiles()
+	for i, file := range secretsFiles {
+		// files with a .dec extension are already decrypted
+		if isOfType(file, []string{".dec"}) {
+			continue
+		}
+		if err := checkSecretsBackend(settings.getSecretsBackend()); err != nil {
+			return nil, err
+		}
+		var err error
+		if secretsFiles[i], err = decryptSecret(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := mergeValuesFiles(values, secretsFiles); err != nil {
+		return nil, err
+	}
+
+	for _, k := range sortedKeys(r.Set) {
+		if err := setValue(values, k, typedValue(r.Set[k])); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range sortedKeys(r.SetString) {
+		if err := setValue(values, k, r.SetString[k]); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range sortedKeys(r.SetFile) {
+		data, err := ioutil.ReadFile(r.SetFile[k])
+		if err != nil {
+			return nil, err
+		}
+		if err := setValue(values, k, string(data)); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// mergeValuesFiles merges values files, in order, into values
+func mergeValuesFiles(values map[string]interface{}, files []string) error {
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fileValues := make(map[string]interface{})
+		if err := yaml.Unmarshal(data, &fileValues); err != nil {
+			return fmt.Errorf("failed to parse values file %s: %w", file, err)
+		}
+		mergeValues(values, fileValues)
+	}
+	return nil
+}
+
+// validateValues validates the merged release values against the chart's values schema
+// and warns about top level keys that don't exist in the chart's default values
+func (r *Release) validateValues(c *ChartInfo) error {
+	if c == nil || c.values == nil {
+		return nil
+	}
+	values, err := r.getMergedValues()
+	if err != nil {
+		return fmt.Errorf("app [ %s ]: failed to merge values: %w", r.Name, err)
+	}
+
+	if len(c.values) > 0 {
+		known := map[string]bool{"global": true}
+		for _, d := range c.Dependencies {
+			known[d.Name] = true
+			if d.Alias != "" {
+				known[d.Alias] = true
+			}
+		}
+		for _, k := range sortedKeys(values) {
+			if _, ok := c.values[k]; !ok && !known[k] {
+				log.Warning(fmt.Sprintf("app [ %s ]: value [ %s ] is not defined in the default values of chart [ %s ]", r.Name, k, c.Name))
+			}
+		}
+	}
+
+	if len(c.schema) == 0 {
+		return nil
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(chartValuesSchemaFile, bytes.NewReader(c.schema)); err != nil {
+		log.Warning(fmt.Sprintf("app [ %s ]: can't load %s of chart [ %s ]: %v", r.Name, chartValuesSchemaFile, c.Name, err))
+		return nil
+	}
+	schema, err := compiler.Compile(chartValuesSchemaFile)
+	if err != nil {
+		log.Warning(fmt.Sprintf("app [ %s ]: can't compile %s of chart [ %s ]: %v", r.Name, chartValuesSchemaFile, c.Name, err))
+		return nil
+	}
+
+	// round trip through JSON so that the validator only sees plain JSON types
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	err = schema.Validate(doc)
+	var ve *jsonschema.ValidationError
+	if errors.As(err, &ve) {
+		var msgs []string
+		for _, cause := range leafValidationErrors(ve) {
+			msgs = append(msgs, fmt.Sprintf("app [ %s ]: value [ %s ]: %s", r.Name, pointerToKeyPath(cause.InstanceLocation), cause.Message))
+		}
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return err
+}
+
+// leafValidationErrors returns the innermost causes of a schema validation error
+func leafValidationErrors(ve *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(ve.Causes) == 0 {
+		return []*jsonschema.ValidationError{ve}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, c := range ve.Causes {
+		leaves = append(leaves, leafValidationErrors(c)...)
+	}
+	return leaves
+}
+
+// pointerToKeyPath converts a JSON pointer (/image/tag) to a helm values key path (image.tag)
+func pointerToKeyPath(ptr string) string {
+	if ptr == "" || ptr == "/" {
+		return "<root>"
+	}
+	var parts []string
+	for _, p := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		p = strings.ReplaceAll(strings.ReplaceAll(p, "~1", "/"), "~0", "~")
+		if _, err := strconv.Atoi(p); err == nil && len(parts) > 0 {
+			parts[len(parts)-1] += "[" + p + "]"
+			continue
+		}
+		parts = append(parts, strings.ReplaceAll(p, ".", `\.`))
+	}
+	return strings.Join(parts, ".")
+}
+
+// mergeValues deep merges src into dst, values from src take precedence
+func mergeValues(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				dst[k] = mergeValues(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// copyValues returns a deep copy of a values map
+func copyValues(src map[string]interface{}) map[string]interface{} {
+	dst := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		dst[k] = copyValue(v)
+	}
+	return dst
+}
+
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return copyValues(val)
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			list[i] = copyValue(item)
+		}
+		return list
+	}
+	return v
+}
+
+// typedValue converts a --set value to the type helm would infer for it
+func typedValue(val string) interface{} {
+	switch strings.ToLower(val) {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if val == "0" {
+		return int64(0)
+	}
+	if len(val) > 0 && val[0] != '0' {
+		if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return i
+		}
+	}
+	return val
+}
+
+// setValue sets a value in a nested values map using the helm --set key syntax, e.g. a.b[0].c
+func setValue(values map[string]interface{}, key string, value interface{}) error {
+	if err := setPath(values, splitKeyPath(key), value); err != nil {
+		return fmt.Errorf("invalid key [ %s ]: %w", key, err)
+	}
+	return nil
+}
+
+// setPath sets a value in a nested map following the given key segments
+func setPath(m map[string]interface{}, parts []string, value interface{}) error {
+	name, indexes, err := parseKeyPart(parts[0])
+	if err != nil {
+		return err
+	}
+	if len(indexes) > 0 {
+		list, err := setInList(m[name], indexes, parts[1:], value)
+		m[name] = list
+		return err
+	}
+	if len(parts) == 1 {
+		m[name] = value
+		return nil
+	}
+	child, ok := m[name].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		m[name] = child
+	}
+	return setPath(child, parts[1:], value)
+}
+
+// setInList sets a value in a (possibly nested) list, growing it as needed
+func setInList(cur interface{}, indexes []int, rest []string, value interface{}) ([]interface{}, error) {
+	list, _ := cur.([]interface{})
+	idx := indexes[0]
+	for len(list) <= idx {
+		list = append(list, nil)
+	}
+	if len(indexes) > 1 {
+		inner, err := setInList(list[idx], indexes[1:], rest, value)
+		list[idx] = inner
+		return list, err
+	}
+	if len(rest) == 0 {
+		list[idx] = value
+		return list, nil
+	}
+	child, ok := list[idx].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		list[idx] = child
+	}
+	return list, setPath(child, rest, value)
+}
+
+// splitKeyPath splits a helm --set key on unescaped dots
+func splitKeyPath(key string) []string {
+	var (
+		parts []string
+		sb    strings.Builder
+	)
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key) && key[i+1] == '.':
+			sb.WriteByte('.')
+			i++
+		case key[i] == '.':
+			parts = append(parts, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteByte(key[i])
+		}
+	}
+	return append(parts, sb.String())
+}
+
+// parseKeyPart parses a key segment with optional list indexes, e.g. name[0][1]
+func parseKeyPart(part string) (string, []int, error) {
+	open := strings.Index(part, "[")
+	if open < 0 {
+		if part == "" {
+			return "", nil, errors.New("empty key segment")
+		}
+		return part, nil, nil
+	}
+	name := part[:open]
+	var indexes []int
+	for rest := part[open:]; rest != ""; {
+		end := strings.Index(rest, "]")
+		if !strings.HasPrefix(rest, "[") || end < 0 {
+			return "", nil, fmt.Errorf("malformed list index in [ %s ]", part)
+		}
+		idx, err := strconv.Atoi(rest[1:end])
+		if err != nil || idx < 0 {
+			return "", nil, fmt.Errorf("invalid list index in [ %s ]", part)
+		}
+		indexes = append(indexes, idx)
+		rest = rest[end+1:]
+	}
+	if name == "" {
+		return "", nil, errors.New("empty key segment")
+	}
+	return name, indexes, nil
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
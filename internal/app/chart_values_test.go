@@ -0,0 +1,230 @@
+package app
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_setValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value interface{}
+		want  map[string]interface{}
+	}{
+		{
+			name:  "nested key",
+			key:   "image.tag",
+			value: "1.0.0",
+			want:  map[string]interface{}{"image": map[string]interface{}{"tag": "1.0.0"}},
+		}, {
+			name:  "escaped dot",
+			key:   `annotations.kubernetes\.io/ingress`,
+			value: "nginx",
+			want:  map[string]interface{}{"annotations": map[string]interface{}{"kubernetes.io/ingress": "nginx"}},
+		}, {
+			name:  "list index",
+			key:   "hosts[1].name",
+			value: "b",
+			want:  map[string]interface{}{"hosts": []interface{}{nil, map[string]interface{}{"name": "b"}}},
+		}, {
+			name:  "nested list index",
+			key:   "matrix[0][1]",
+			value: int64(2),
+			want:  map[string]interface{}{"matrix": []interface{}{[]interface{}{nil, int64(2)}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]interface{})
+			if err := setValue(got, tt.key, tt.value); err != nil {
+				t.Fatalf("setValue() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_typedValue(t *testing.T) {
+	tests := map[string]interface{}{
+		"true":  true,
+		"False": false,
+		"null":  nil,
+		"0":     int64(0),
+		"42":    int64(42),
+		"0042":  "0042",
+		"1.5":   "1.5",
+		"a,b":   "a,b",
+	}
+	for in, want := range tests {
+		if got := typedValue(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("typedValue(%q) = %#v, want %#v", in, got, want)
+		}
+	}
+}
+
+func Test_mergeValues(t *testing.T) {
+	dst := map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "nginx", "tag": "1.0"},
+		"replicas": float64(1),
+	}
+	src := map[string]interface{}{
+		"image": map[string]interface{}{"tag": "2.0"},
+		"extra": true,
+	}
+	want := map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "nginx", "tag": "2.0"},
+		"replicas": float64(1),
+		"extra":    true,
+	}
+	if got := mergeValues(dst, src); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeValues() = %v, want %v", got, want)
+	}
+}
+
+func Test_pointerToKeyPath(t *testing.T) {
+	tests := map[string]string{
+		"":                    "<root>",
+		"/image/tag":          "image.tag",
+		"/hosts/0/name":       "hosts[0].name",
+		"/annotations/a.b~1c": `annotations.a\.b/c`,
+	}
+	for in, want := range tests {
+		if got := pointerToKeyPath(in); got != want {
+			t.Errorf("pointerToKeyPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func Test_release_validateValues(t *testing.T) {
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "chart")
+	if err := os.MkdirAll(chart, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(chart, chartValuesFile): "replicaCount: 1\nimage:\n  tag: latest\n",
+		filepath.Join(chart, chartValuesSchemaFile): `{
+  "type": "object",
+  "properties": {
+    "replicaCount": {"type": "integer", "minimum": 1},
+    "image": {"type": "object", "properties": {"tag": {"type": "string"}}}
+  }
+}`,
+		filepath.Join(dir, "values.yaml"): "image:\n  tag: v1\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &ChartInfo{Name: "chart", Version: "1.0.0"}
+	if err := c.loadValues(chart); err != nil {
+		t.Fatalf("loadValues() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		release *Release
+		wantErr string
+	}{
+		{
+			name: "valid values",
+			release: &Release{
+				Name:        "app",
+				ValuesFiles: []string{filepath.Join(dir, "values.yaml")},
+				Set:         map[string]string{"replicaCount": "3"},
+			},
+		}, {
+			name: "invalid set value",
+			release: &Release{
+				Name: "app",
+				Set:  map[string]string{"replicaCount": "0"},
+			},
+			wantErr: "app [ app ]: value [ replicaCount ]",
+		}, {
+			name: "invalid setString type",
+			release: &Release{
+				Name:      "app",
+				SetString: map[string]string{"replicaCount": "3"},
+			},
+			wantErr: "app [ app ]: value [ replicaCount ]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.release.validateValues(c)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateValues() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateValues() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_release_validateValues_secretsFiles(t *testing.T) {
+	dir := t.TempDir()
+	secrets := filepath.Join(dir, "secrets.yaml.dec")
+	if err := os.WriteFile(secrets, []byte("password: s3cr3t\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &ChartInfo{Name: "chart", Version: "1.0.0", values: map[string]interface{}{"password": ""}}
+	c.schema = []byte(`{"type": "object", "required": ["password"], "properties": {"password": {"type": "string", "minLength": 1}}}`)
+
+	// the required value is only set in the secrets files, which are passed to helm too
+	r := &Release{Name: "app", SecretsFiles: []string{secrets}}
+	if err := r.validateValues(c); err != nil {
+		t.Errorf("validateValues() unexpected error = %v", err)
+	}
+	if err := (&Release{Name: "app"}).validateValues(c); err == nil || !strings.Contains(err.Error(), "password") {
+		t.Errorf("validateValues() error = %v, want a missing password error", err)
+	}
+}
+
+func Test_readChartArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "chart-1.0.0.tgz")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	files := map[string]string{
+		"chart/" + chartFile:                  "name: chart\nversion: 1.0.0\n",
+		"chart/" + chartValuesFile:            "replicaCount: 1\n",
+		"chart/templates/deployment.yaml":     "kind: Deployment\n",
+		"chart/charts/dep/" + chartValuesFile: "other: true\n",
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	got, err := readChartArchive(archive)
+	if err != nil {
+		t.Fatalf("readChartArchive() error = %v", err)
+	}
+	if len(got) != 2 || string(got[chartFile]) != files["chart/"+chartFile] || string(got[chartValuesFile]) != "replicaCount: 1\n" {
+		t.Errorf("readChartArchive() = %v, want the top level Chart.yaml and values.yaml", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path"
 	"strings"
 )
 
@@ -54,6 +55,7 @@ func (i *stringArray) Set(value string) error {
 }
 
 type cli struct {
+	command               string
 	debug                 bool
 	files                 fileOptionArray
 	spec                  string
@@ -62,6 +64,7 @@ type cli struct {
 	targetExcluded        stringArray
 	group                 stringArray
 	groupExcluded         stringArray
+	selector              stringArray
 	kubeconfig            string
 	apply                 bool
 	destroy               bool
@@ -95,10 +98,21 @@ type cli struct {
 	kubectlDiff           bool
 	downloadCharts        bool
 	checkForChartUpdates  bool
+	checkPodSecurity      bool
 	skipIgnoredApps       bool
 	skipPendingApps       bool
 	pendingAppRetries     int
 	showSecrets           bool
+	exportState           string
+	exportStateSources    bool
+	importNamespaces      stringArray
+	importOutput          string
+	importLabel           bool
+	cluster               string
+	lock                  bool
+	frozenLockfile        bool
+	outdatedFormat        string
+	updateCharts          string
 }
 
 func printUsage() {
@@ -107,6 +121,8 @@ func printUsage() {
 	fmt.Println("Helmsman is a Helm Charts as Code tool which allows you to automate the deployment/management of your Helm charts.")
 	fmt.Println("")
 	fmt.Printf("Usage: helmsman [options]\n")
+	fmt.Printf("       helmsman import [options]\n")
+	fmt.Printf("       helmsman outdated [options]\n")
 	flag.PrintDefaults()
 }
 
@@ -114,9 +130,10 @@ func (c *cli) setup() {
 	// parsing command line flags
 	flag.Var(&c.files, "f", "desired state file name(s), may be supplied more than once to merge state files")
 	flag.Var(&c.envFiles, "e", "additional file(s) to load environment variables from, may be supplied more than once, it extends default .env file lookup, every next file takes precedence over previous ones in case of having the same environment variables defined")
-	flag.Var(&c.target, "target", "limit execution to specific app.")
+	flag.Var(&c.target, "target", "limit execution to specific app. Accepts glob patterns, e.g. 'monitoring-*'.")
 	flag.Var(&c.group, "group", "limit execution to specific group of apps.")
-	flag.Var(&c.targetExcluded, "exclude-target", "exclude specific app from execution.")
+	flag.Var(&c.targetExcluded, "exclude-target", "exclude specific app from execution. Accepts glob patterns.")
+	flag.Var(&c.selector, "selector", "limit execution to apps whose labels match a label selector, e.g. 'tier=backend,env!=prod,team in (a,b)'. May be supplied more than once to select apps matching any of the selectors.")
 	flag.Var(&c.groupExcluded, "exclude-group", "exclude specific group of apps from execution.")
 	flag.IntVar(&c.diffContext, "diff-context", -1, "number of lines of context to show around changes in helm diff output")
 	flag.IntVar(&c.parallel, "p", 1, "max number of concurrent helm releases to run")
@@ -133,7 +150,7 @@ func (c *cli) setup() {
 	flag.BoolVar(&c.noBanner, "no-banner", false, "don't show the banner")
 	flag.BoolVar(&c.noColors, "no-color", false, "don't use colors")
 	flag.BoolVar(&c.noFancy, "no-fancy", false, "don't display the banner and don't use colors")
-	flag.BoolVar(&c.noNs, "no-ns", false, "don't create namespaces")
+	flag.BoolVar(&c.noNs, "no-ns", false, "don't plan any namespace change")
 	flag.BoolVar(&c.skipValidation, "skip-validation", false, "skip desired state validation")
 	flag.BoolVar(&c.keepUntrackedReleases, "keep-untracked-releases", false, "keep releases that are managed by Helmsman from the used DSFs in the command, and are no longer tracked in your desired state.")
 	flag.BoolVar(&c.showDiff, "show-diff", false, "show helm diff results. Can expose sensitive information.")
@@ -141,24 +158,41 @@ func (c *cli) setup() {
 	flag.BoolVar(&c.noEnvSubst, "no-env-subst", false, "turn off environment substitution globally")
 	flag.BoolVar(&c.substEnvValues, "subst-env-values", false, "turn on environment substitution in values files.")
 	flag.BoolVar(&c.noRecursiveEnvExpand, "no-recursive-env-expand", false, "disable recursive environment values expansion")
-	flag.BoolVar(&c.noSSMSubst, "no-ssm-subst", false, "turn off SSM parameter substitution globally")
-	flag.BoolVar(&c.substSSMValues, "subst-ssm-values", false, "turn on SSM parameter substitution in values files.")
+	flag.BoolVar(&c.noSSMSubst, "no-ssm-subst", false, "turn off the substitution of SSM parameters and other secret references ({{ssm: name}}, {{vault: path#key}}, ...) globally")
+	flag.BoolVar(&c.substSSMValues, "subst-ssm-values", false, "turn on the substitution of SSM parameters and other secret references in values files.")
 	flag.BoolVar(&c.updateDeps, "update-deps", false, "run 'helm dep up' for local charts")
 	flag.BoolVar(&c.forceUpgrades, "force-upgrades", false, "use --force when upgrading helm releases. May cause resources to be recreated.")
 	flag.BoolVar(&c.renameReplace, "replace-on-rename", false, "uninstall the existing release when a chart with a different name is used.")
-	flag.BoolVar(&c.noCleanup, "no-cleanup", false, "keeps any credentials files that has been downloaded on the host where helmsman runs.")
+	flag.BoolVar(&c.noCleanup, "no-cleanup", false, "keeps any credentials files that has been downloaded on the host where helmsman runs. Decrypted secrets are always deleted.")
 	flag.BoolVar(&c.migrateContext, "migrate-context", false, "updates the context name for all apps defined in the DSF and applies Helmsman labels. Using this flag is required if you want to change context name after it has been set.")
 	flag.BoolVar(&c.alwaysUpgrade, "always-upgrade", false, "upgrade release even if no changes are found")
 	flag.BoolVar(&c.noUpdate, "no-update", false, "skip updating helm repos")
 	flag.BoolVar(&c.kubectlDiff, "kubectl-diff", false, "use kubectl diff instead of helm diff. Defalts to false if the helm diff plugin is installed.")
 	flag.BoolVar(&c.checkForChartUpdates, "check-for-chart-updates", false, "compares the chart versions in the state file to the latest versions in the chart repositories and shows available updates")
+	flag.BoolVar(&c.checkPodSecurity, "check-pod-security", false, "checks which pods would be rejected by the new podSecurity enforce levels of the namespaces, and warns about them. Running pods are checked with a server-side dry-run, the pods rendered by the apps to install or upgrade are evaluated against the new level and version")
 	flag.BoolVar(&c.downloadCharts, "download-charts", false, "download charts referenced by URLs in the state file")
 	flag.BoolVar(&c.skipIgnoredApps, "skip-ignored", false, "skip ignored apps")
 	flag.BoolVar(&c.skipPendingApps, "skip-pending", false, "skip pending helm releases")
 	flag.IntVar(&c.pendingAppRetries, "pending-max-retries", 0, "max number of retries for pending helm releases")
 	flag.BoolVar(&c.showSecrets, "show-secrets", false, "show helm diff results with secrets.")
+	flag.StringVar(&c.exportState, "export-state", "", "write the effective merged desired state to a yaml, toml or json file and exit without touching the cluster. Secrets are redacted.")
+	flag.BoolVar(&c.exportStateSources, "export-state-sources", false, "record in the exported state which desired state file each app field came from.")
+	flag.StringVar(&c.cluster, "cluster", "", "only run against this cluster from the clusters section of the desired state.")
+	flag.BoolVar(&c.lock, "lock", false, "resolve the chart versions of the apps again and record them in the helmsman.lock file next to the first desired state file.")
+	flag.BoolVar(&c.frozenLockfile, "frozen-lockfile", false, "fail if any app is not locked or its chart doesn't match the helmsman.lock file.")
+	flag.Var(&c.importNamespaces, "namespace", "import: namespace to import helm releases from, may be supplied more than once. Defaults to all namespaces.")
+	flag.StringVar(&c.importOutput, "output", "helmsman.yaml", "import: the desired state file to generate. Values files are written to a values directory next to it.")
+	flag.BoolVar(&c.importLabel, "label-releases", false, "import: apply Helmsman labels for the context given with --context-override to the imported releases.")
+	flag.StringVar(&c.outdatedFormat, "format", "table", "outdated: the format of the report of available chart updates, table or json.")
+	flag.StringVar(&c.updateCharts, "update-charts", "", "outdated: rewrite the app versions in the desired state files to the newest chart versions up to a patch, minor or major update.")
 	flag.Usage = printUsage
-	flag.Parse()
+
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == importCommand || args[0] == outdatedCommand) {
+		c.command = args[0]
+		args = args[1:]
+	}
+	_ = flag.CommandLine.Parse(args)
 }
 
 // Cli parses cmd flags, validates them and performs some initializations
@@ -173,7 +207,13 @@ func (c *cli) parse() {
 		c.noBanner = true
 	}
 	verbose := c.verbose || c.debug
-	initLogs(verbose, c.noColors)
+	logsOut := os.Stdout
+	if c.command == outdatedCommand && c.outdatedFormat == "json" {
+		// keep the report on stdout parseable
+		logsOut = os.Stderr
+		c.noBanner = true
+	}
+	initLogs(verbose, c.noColors, logsOut)
 
 	if !c.noBanner {
 		fmt.Printf("%s version: %s\n%s", banner, appVersion, slogan)
@@ -191,6 +231,12 @@ func (c *cli) parse() {
 		log.Fatal("--target and --group can't be used together.")
 	}
 
+	for _, t := range append(c.target, c.targetExcluded...) {
+		if _, err := path.Match(t, ""); err != nil {
+			log.Fatal("invalid target pattern [ " + t + " ]: " + err.Error())
+		}
+	}
+
 	if len(flags.files) > 0 && len(flags.spec) > 0 {
 		log.Fatal("-f and -spec can't be used together.")
 	}
@@ -199,6 +245,46 @@ func (c *cli) parse() {
 		c.parallel = 1
 	}
 
+	if c.cluster != "" {
+		// keep the temporary files of clusters running in parallel apart
+		tempFilesDir += "-" + c.cluster
+	}
+
+	if c.exportState != "" && !isOfType(c.exportState, []string{".yaml", ".yml", ".toml", ".tml", ".json"}) {
+		log.Fatal("--export-state file must have a yaml, toml or json extension.")
+	}
+
+	if c.exportStateSources && c.exportState == "" {
+		log.Fatal("--export-state-sources can only be used with --export-state.")
+	}
+
+	if c.lock && c.frozenLockfile {
+		log.Fatal("--lock and --frozen-lockfile can't be used together.")
+	}
+
+	if c.command == outdatedCommand {
+		if len(c.files) == 0 && len(c.spec) == 0 {
+			log.Fatal("outdated needs desired state files.")
+		}
+		if !stringInSlice(c.outdatedFormat, outdatedReportFormat) {
+			log.Fatal("--format must be one of: " + strings.Join(outdatedReportFormat, ", ") + ".")
+		}
+		if c.updateCharts != "" && !stringInSlice(c.updateCharts, updateLevels) {
+			log.Fatal("--update-charts must be one of: " + strings.Join(updateLevels, ", ") + ".")
+		}
+	} else if c.updateCharts != "" {
+		log.Fatal("--update-charts can only be used with the outdated command.")
+	}
+
+	if c.command == importCommand {
+		if len(c.files) > 0 || len(c.spec) > 0 {
+			log.Fatal("import does not take desired state files.")
+		}
+		if !isOfType(c.importOutput, []string{".yaml", ".yml", ".toml", ".tml"}) {
+			log.Fatal("--output file must have a yaml or toml extension.")
+		}
+	}
+
 	log.Verbose("Helm client version: " + strings.TrimSpace(getHelmVersion()))
 	if checkHelmVersion("<3.0.0") {
 		log.Fatal("this version of Helmsman does not work with helm releases older than 3.0.0")
@@ -207,7 +293,7 @@ func (c *cli) parse() {
 	kubectlVersion := getKubectlVersion()
 	log.Verbose("kubectl client version: " + kubectlVersion)
 
-	if len(c.files) == 0 && len(c.spec) == 0 {
+	if c.command == "" && len(c.files) == 0 && len(c.spec) == 0 {
 		log.Info("No desired state files provided.")
 		os.Exit(0)
 	}
@@ -224,6 +310,10 @@ func (c *cli) parse() {
 		log.Fatal("" + helmBin + " is not installed/configured correctly. Aborting!")
 	}
 
+	if c.command != "" {
+		return
+	}
+
 	if !c.kubectlDiff && !helmPluginExists("diff") {
 		c.kubectlDiff = true
 		log.Warning("helm diff not found, using kubectl diff")
@@ -241,9 +331,9 @@ func (c *cli) parse() {
 	}
 
 	if !c.noSSMSubst {
-		log.Verbose("Substitution of SSM variables enabled")
+		log.Verbose("Substitution of secret references enabled")
 		if c.substSSMValues {
-			log.Verbose("Substitution of SSM variables in values enabled")
+			log.Verbose("Substitution of secret references in values enabled")
 		}
 	}
 }
@@ -285,8 +375,14 @@ func (c *cli) readState(s *State) error {
 	if err := s.build(c.files); err != nil {
 		return fmt.Errorf("error building the state from files: %w", err)
 	}
+	// register the secrets before the state is validated or printed, their values must never be shown
+	redactions.add(s.sensitiveValues()...)
 
-	s.disableApps(c.group, c.target, c.groupExcluded, c.targetExcluded)
+	selectors, err := parseSelectors(c.selector)
+	if err != nil {
+		return err
+	}
+	s.disableApps(c.group, c.target, c.groupExcluded, c.targetExcluded, selectors)
 
 	if c.skipIgnoredApps {
 		s.Settings.SkipIgnoredApps = true
@@ -1,6 +1,12 @@
 package app
 
-import "testing"
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 var _ = func() bool {
 	testing.Init()
@@ -124,3 +130,54 @@ func Test_readState(t *testing.T) {
 		})
 	}
 }
+
+func Test_readState_debugRedactsSecrets(t *testing.T) {
+	defer redactions.reset()
+	t.Setenv("HELMSMAN_TEST_TOKEN", "env-t0ken-value")
+	dsf := filepath.Join(t.TempDir(), "dsf.yaml")
+	content := `settings:
+  password: "cluster-passw0rd"
+  sensitiveEnvVars: [HELMSMAN_TEST_TOKEN]
+helmRepos:
+  repo: https://charts.example.com
+namespaces:
+  staging: {}
+apps:
+  app:
+    namespace: staging
+    chart: repo/app
+    version: 1.0.0
+    enabled: true
+    sensitiveKeys: [db.password]
+    set:
+      db.password: "db-s3cret-value"
+      token: "$HELMSMAN_TEST_TOKEN"
+`
+	if err := os.WriteFile(dsf, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	c := cli{files: fileOptionArray{{dsf, 0}}, skipValidation: true, debug: true}
+	readErr := c.readState(&State{})
+	w.Close()
+	os.Stdout = stdout
+	out, _ := io.ReadAll(r)
+
+	if readErr != nil {
+		t.Fatalf("readState() unexpected error: %v", readErr)
+	}
+	if !strings.Contains(string(out), "******") {
+		t.Errorf("readState() with --debug did not print the masked values:\n%s", out)
+	}
+	for _, secret := range []string{"cluster-passw0rd", "env-t0ken-value", "db-s3cret-value"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("readState() with --debug printed the secret %q:\n%s", secret, out)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cluster type represents a k8s cluster the desired state is deployed to
+type Cluster struct {
+	// KubeContext is the name of the kubectl context used to connect to the cluster
+	KubeContext string `json:"kubeContext"`
+	// Apps overrides the settings of apps for this cluster, e.g. to disable them or change their values
+	Apps map[string]*Release `json:"apps,omitempty"`
+}
+
+// clusterResult holds the outcome of running helmsman against one cluster
+type clusterResult struct {
+	name     string
+	context  string
+	exitCode int
+	err      error
+	duration time.Duration
+}
+
+// applyCluster applies the settings and app overrides of a cluster to the state
+func (s *State) applyCluster(name string) error {
+	cluster, ok := s.Clusters[name]
+	if !ok || cluster == nil {
+		return fmt.Errorf("cluster [ %s ] is not defined in the clusters section of your desired state", name)
+	}
+	if cluster.KubeContext == "" {
+		return fmt.Errorf("cluster [ %s ] has no kubeContext", name)
+	}
+	s.Settings.KubeContext = cluster.KubeContext
+	for appName, override := range cluster.Apps {
+		app, ok := s.Apps[appName]
+		if !ok || app == nil {
+			return fmt.Errorf("cluster [ %s ] overrides app [ %s ] which is not defined in apps", name, appName)
+		}
+		if override == nil {
+			continue
+		}
+		if err := mergeRelease(app, override); err != nil {
+			return fmt.Errorf("cluster [ %s ]: failed to override app [ %s ]: %w", name, appName, err)
+		}
+	}
+	return nil
+}
+
+// runClusters runs helmsman against every cluster of the desired state in parallel and prints a combined summary.
+// Each cluster is handled by a separate helmsman process with a kubeconfig that only holds the cluster's context.
+func runClusters(s *State) int {
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal("failed to find the helmsman executable: " + err.Error())
+	}
+
+	names := make([]string, 0, len(s.Clusters))
+	for name := range s.Clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Info("Running against clusters [ " + strings.Join(names, ", ") + " ]")
+
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		results = make([]clusterResult, len(names))
+	)
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer cleanupOnPanic()
+			defer wg.Done()
+			start := time.Now()
+			result := clusterResult{name: name, context: s.Clusters[name].KubeContext}
+			result.exitCode, result.err = runCluster(self, name, result.context, &mutex)
+			result.duration = time.Since(start).Round(time.Second)
+			results[i] = result
+		}(i, name)
+	}
+	wg.Wait()
+
+	printClustersSummary(results)
+	return clustersExitCode(results)
+}
+
+// runCluster runs a helmsman process for a single cluster and streams its output prefixed with the cluster name
+func runCluster(self, name, kubeContext string, mutex *sync.Mutex) (int, error) {
+	kubeconfig, err := isolateKubeContext(name, kubeContext)
+	if err != nil {
+		return 1, err
+	}
+
+	args := concat(os.Args[1:], []string{"--cluster", name, "--kubeconfig", kubeconfig, "--no-banner", "--detailed-exit-code"})
+	cmd := exec.Command(self, args...)
+	out := &prefixWriter{prefix: "[" + name + "] ", out: os.Stdout, mutex: mutex}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err = cmd.Run()
+	out.Flush()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return exitCodeSucceed, nil
+}
+
+// isolateKubeContext writes a kubeconfig file that only holds the given context, with its credentials inlined
+func isolateKubeContext(name, kubeContext string) (string, error) {
+	cmd := kubectl([]string{"config", "view", "--minify", "--flatten", "--context", kubeContext}, "Extracting kubectl context [ "+kubeContext+" ] for cluster [ "+name+" ]")
+	res, err := cmd.Exec()
+	if err != nil {
+		return "", fmt.Errorf("failed to extract kubectl context [ %s ]: %w", kubeContext, err)
+	}
+	file := filepath.Join(tempFilesDir, "kubeconfig-"+name)
+	if err := os.WriteFile(file, []byte(res.output), 0o600); err != nil {
+		return "", err
+	}
+	return filepath.Abs(file)
+}
+
+// printClustersSummary prints the outcome of every cluster run
+func printClustersSummary(results []clusterResult) {
+	log.Notice("-------- CLUSTERS SUMMARY starts here --------------")
+	for _, r := range results {
+		msg := fmt.Sprintf("Cluster [ %s ] with context [ %s ] ", r.name, r.context)
+		switch {
+		case r.err != nil:
+			log.Error(msg + "failed: " + r.err.Error())
+		case r.exitCode == exitCodeSucceedWithChanges:
+			log.Notice(msg + "succeeded with changes in " + r.duration.String())
+		case r.exitCode == exitCodeSucceed:
+			log.Notice(msg + "succeeded without changes in " + r.duration.String())
+		default:
+			log.Error(fmt.Sprintf("%sfailed with exit code %d in %s", msg, r.exitCode, r.duration))
+		}
+	}
+	log.Notice("-------- CLUSTERS SUMMARY ends here --------------")
+}
+
+// clustersExitCode combines the exit codes of the cluster runs, any failure fails the whole run
+func clustersExitCode(results []clusterResult) int {
+	exitCode := exitCodeSucceed
+	for _, r := range results {
+		switch {
+		case r.err != nil || (r.exitCode != exitCodeSucceed && r.exitCode != exitCodeSucceedWithChanges):
+			return 1
+		case r.exitCode == exitCodeSucceedWithChanges && flags.detailedExitCode:
+			exitCode = exitCodeSucceedWithChanges
+		}
+	}
+	return exitCode
+}
+
+// prefixWriter writes every line it receives prefixed, so the output of parallel processes can be told apart
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	mutex  *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			// keep the incomplete line for the next write
+			w.buf.Write(line)
+			break
+		}
+		w.writeLine(line)
+	}
+	return len(p), nil
+}
+
+// Flush writes what is left of an incomplete last line
+func (w *prefixWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.writeLine(append(w.buf.Bytes(), '\n'))
+		w.buf.Reset()
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, _ = w.out.Write(append([]byte(w.prefix), line...))
+}
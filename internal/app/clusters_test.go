@@ -0,0 +1,87 @@
+package app
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_state_applyCluster(t *testing.T) {
+	s := &State{
+		Apps: map[string]*Release{
+			"api":    {Name: "api", Enabled: True, Values: map[string]interface{}{"replicas": 1, "image": map[string]interface{}{"tag": "v1"}}},
+			"worker": {Name: "worker", Enabled: True},
+		},
+		Clusters: map[string]*Cluster{
+			"eu": {
+				KubeContext: "eu-prod",
+				Apps: map[string]*Release{
+					"api":    {Values: map[string]interface{}{"replicas": 3}},
+					"worker": {Enabled: False},
+				},
+			},
+			"broken": {KubeContext: "us", Apps: map[string]*Release{"missing": {}}},
+		},
+	}
+	if err := s.applyCluster("eu"); err != nil {
+		t.Fatalf("applyCluster() unexpected error: %v", err)
+	}
+	if s.Settings.KubeContext != "eu-prod" {
+		t.Errorf("applyCluster() kubeContext = %s, want eu-prod", s.Settings.KubeContext)
+	}
+	wantValues := map[string]interface{}{"replicas": 3, "image": map[string]interface{}{"tag": "v1"}}
+	if !reflect.DeepEqual(s.Apps["api"].Values, wantValues) {
+		t.Errorf("applyCluster() api values = %v, want %v", s.Apps["api"].Values, wantValues)
+	}
+	if s.Apps["worker"].Enabled.Value {
+		t.Errorf("applyCluster() wanted worker to be disabled")
+	}
+
+	if err := s.applyCluster("broken"); err == nil || !strings.Contains(err.Error(), "app [ missing ]") {
+		t.Errorf("applyCluster() error = %v, want an error about the missing app", err)
+	}
+	if err := s.applyCluster("unknown"); err == nil {
+		t.Errorf("applyCluster() expected an error for an undefined cluster")
+	}
+}
+
+func Test_prefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{prefix: "[eu] ", out: &out, mutex: &sync.Mutex{}}
+	w.Write([]byte("first li"))
+	w.Write([]byte("ne\nsecond line\nlast"))
+	w.Flush()
+	want := "[eu] first line\n[eu] second line\n[eu] last\n"
+	if out.String() != want {
+		t.Errorf("prefixWriter wrote %q, want %q", out.String(), want)
+	}
+}
+
+func Test_clustersExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		detailed bool
+		codes    []int
+		want     int
+	}{
+		{name: "all succeeded", codes: []int{0, 0}, want: 0},
+		{name: "changes without detailed exit code", codes: []int{0, 2}, want: 0},
+		{name: "changes with detailed exit code", detailed: true, codes: []int{0, 2}, want: 2},
+		{name: "one failed", detailed: true, codes: []int{2, 1}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(v bool) { flags.detailedExitCode = v }(flags.detailedExitCode)
+			flags.detailedExitCode = tt.detailed
+			var results []clusterResult
+			for _, c := range tt.codes {
+				results = append(results, clusterResult{exitCode: c})
+			}
+			if got := clustersExitCode(results); got != tt.want {
+				t.Errorf("clustersExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -31,7 +31,7 @@ func (e ExitStatus) String() string {
 	if errs := strings.TrimSpace(e.errors); errs != "" {
 		str = fmt.Sprintf("%s\n--- stderr ---\n%s", str, errs)
 	}
-	return str
+	return redactions.redact(str)
 }
 
 func (c *Command) String() string {
@@ -62,7 +62,7 @@ func (c *Command) String() string {
 		}
 		sb.WriteString(arg)
 	}
-	return sb.String()
+	return redactions.redact(sb.String())
 }
 
 // RetryExec runs exec command with retry
@@ -232,12 +232,12 @@ func call(stack []*exec.Cmd) (err error) {
 func newExitError(cmd string, code int, stdout, stderr string, cause error) error {
 	return fmt.Errorf(
 		"%s failed with non-zero exit code %d: %w\noutput: %s",
-		cmd, code, cause,
-		fmt.Sprintf(
+		redactions.redact(cmd), code, cause,
+		redactions.redact(fmt.Sprintf(
 			"\n--- stdout ---\n%s\n--- stderr ---\n%s",
 			strings.TrimSpace(stdout),
 			strings.TrimSpace(stderr),
-		),
+		)),
 	)
 }
 
@@ -2,6 +2,7 @@ package app
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"strconv"
 
@@ -63,6 +64,54 @@ func (NullBool) JSONSchema() *jsonschema.Schema {
 	}
 }
 
+// StringList represents a list of strings that may also be written as a single string.
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = StringList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %w", err)
+	}
+	*l = list
+	return nil
+}
+
+func (l *StringList) UnmarshalTOML(data interface{}) error {
+	switch v := data.(type) {
+	case string:
+		*l = StringList{v}
+	case []interface{}:
+		list := make(StringList, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected a string or a list of strings, got %v", data)
+			}
+			list = append(list, str)
+		}
+		*l = list
+	default:
+		return fmt.Errorf("expected a string or a list of strings, got %v", data)
+	}
+	return nil
+}
+
+// JSONSchema instructs the jsonschema generator to represent StringList type as a string or an array of strings
+func (StringList) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		OneOf: []*jsonschema.Schema{
+			{Type: "string"},
+			{Type: "array", Items: &jsonschema.Schema{Type: "string"}},
+		},
+	}
+}
+
 type MergoTransformer func(typ reflect.Type) func(dst, src reflect.Value) error
 
 func (m MergoTransformer) Transformer(typ reflect.Type) func(dst, src reflect.Value) error {
@@ -177,3 +177,29 @@ func TestNullBoolTransformer(t *testing.T) {
 		})
 	}
 }
+
+func TestStringList_Unmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		toml interface{}
+		want StringList
+	}{
+		{name: "single string", json: `"base"`, toml: "base", want: StringList{"base"}},
+		{name: "list", json: `["base", "monitored"]`, toml: []interface{}{"base", "monitored"}, want: StringList{"base", "monitored"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromJSON, fromTOML StringList
+			if err := json.Unmarshal([]byte(tt.json), &fromJSON); err != nil {
+				t.Fatalf("UnmarshalJSON() error = %v", err)
+			}
+			if err := fromTOML.UnmarshalTOML(tt.toml); err != nil {
+				t.Fatalf("UnmarshalTOML() error = %v", err)
+			}
+			if !reflect.DeepEqual(fromJSON, tt.want) || !reflect.DeepEqual(fromTOML, tt.want) {
+				t.Errorf("Unmarshal() = %v and %v, want %v", fromJSON, fromTOML, tt.want)
+			}
+		})
+	}
+}
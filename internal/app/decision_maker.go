@@ -36,6 +36,7 @@ func (s *State) getCurrentState() *currentState {
 		sem <- struct{}{}
 		wg.Add(1)
 		go func(r helmRelease) {
+			defer cleanupOnPanic()
 			defer func() {
 				wg.Done()
 				// release
@@ -74,6 +75,7 @@ func (cs *currentState) makePlan(s *State) *plan {
 		sem <- struct{}{}
 		wg.Add(1)
 		go func(r *Release, c *ChartInfo) {
+			defer cleanupOnPanic()
 			defer func() {
 				wg.Done()
 				<-sem
@@ -224,6 +226,7 @@ func (cs *currentState) getHelmsmanReleases(s *State) map[string]map[string]bool
 		sem <- struct{}{}
 		wg.Add(1)
 		go func(ns string) {
+			defer cleanupOnPanic()
 			var lines []string
 			defer func() {
 				wg.Done()
@@ -335,6 +338,7 @@ func (cs *currentState) inspectUpgradeScenario(r *Release, p *plan, c *ChartInfo
 		return nil
 	}
 
+	// c is resolved from the version in the lock file when the app is locked
 	r.Version = c.Version
 
 	// Chart changed
@@ -353,7 +357,7 @@ func (cs *currentState) inspectUpgradeScenario(r *Release, p *plan, c *ChartInfo
 			if diff, err := r.diff(); err != nil {
 				log.Error(err.Error())
 			} else if diff != "" {
-				fmt.Println(diff)
+				fmt.Println(redactions.redact(diff))
 			}
 		}
 		r.upgrade(p)
@@ -365,7 +369,7 @@ func (cs *currentState) inspectUpgradeScenario(r *Release, p *plan, c *ChartInfo
 		return err
 	} else if diff != "" {
 		if flags.verbose || flags.showDiff {
-			fmt.Println(diff)
+			fmt.Println(redactions.redact(diff))
 		}
 		r.upgrade(p)
 		p.addDecision("Release [ "+r.Name+" ] will be updated", r.Priority, change)
@@ -278,7 +278,7 @@ func Test_decide(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := newCurrentState()
-			tt.args.s.disableApps([]string{}, tt.targetFlag, tt.excludedGroupFlag, tt.excludedTargetFlag)
+			tt.args.s.disableApps([]string{}, tt.targetFlag, tt.excludedGroupFlag, tt.excludedTargetFlag, nil)
 			settings := Config{}
 			outcome := plan{}
 			// Act
@@ -357,7 +357,7 @@ func Test_decide_skip_ignored_apps(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := newCurrentState()
-			tt.args.s.disableApps([]string{}, tt.targetFlag, []string{}, []string{})
+			tt.args.s.disableApps([]string{}, tt.targetFlag, []string{}, []string{}, nil)
 			settings := Config{
 				SkipIgnoredApps: true,
 			}
@@ -442,7 +442,7 @@ func Test_decide_group(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.args.s.disableApps(tt.groupFlag, []string{}, []string{}, []string{})
+			tt.args.s.disableApps(tt.groupFlag, []string{}, []string{}, []string{}, nil)
 			if len(tt.args.s.targetMap) != len(tt.want) {
 				t.Errorf("decide() = %d, want %d", len(tt.args.s.targetMap), len(tt.want))
 			}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envExpander expands env variables with a subset of the shell syntax:
+// $VAR and ${VAR} are replaced with the value of VAR,
+// ${VAR:-default} is replaced with default when VAR is unset or empty,
+// ${VAR:?message} fails with message when VAR is unset or empty,
+// ${VAR:+alt} is replaced with alt when VAR is set and not empty, and with nothing otherwise,
+// and $$ is a literal $. Special parameters, e.g. $1 or $@, are replaced with nothing unless such a variable is set.
+type envExpander struct {
+	// problems lists the unset variables and the required ones that are missing
+	problems []string
+	// checkUnset reports plain variables that are unset, required variables are always reported
+	checkUnset bool
+}
+
+// expand replaces the env variables in a string
+func (e *envExpander) expand(s string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] != '$' || i+1 == len(s) {
+			buf.WriteByte(s[i])
+			i++
+			continue
+		}
+		switch c := s[i+1]; {
+		case c == '$':
+			buf.WriteByte('$')
+			i += 2
+		case c == '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				// unterminated, leave it as is
+				buf.WriteString(s[i:])
+				return buf.String()
+			}
+			buf.WriteString(e.expandBraces(s[i:end+1], s[i+2:end]))
+			i = end + 1
+		case isEnvNameStart(c):
+			j := i + 2
+			for j < len(s) && isEnvNameChar(s[j]) {
+				j++
+			}
+			buf.WriteString(e.variable(s[i:j], s[i+1:j]))
+			i = j
+		case isShellSpecialVar(c):
+			// special parameters, e.g. $1 or $@, are looked up like with os.Expand, which substituteEnv used before
+			buf.WriteString(getEnv(string(c)))
+			i += 2
+		default:
+			buf.WriteByte('$')
+			i++
+		}
+	}
+	return buf.String()
+}
+
+// expandBraces expands a ${...} expression, raw is the whole expression and body what is inside the braces
+func (e *envExpander) expandBraces(raw, body string) string {
+	n := 0
+	for n < len(body) && (isEnvNameStart(body[n]) || (n > 0 && (isEnvNameChar(body[n]) || body[n] == '-'))) {
+		n++
+	}
+	name, rest := body[:n], body[n:]
+	if name == "" {
+		// not a variable name, e.g. ${1} or ${@}, looked up as is like with os.Expand
+		return getEnv(body)
+	}
+	if rest == "" {
+		return e.variable(raw, name)
+	}
+	if len(rest) < 2 || rest[0] != ':' {
+		return raw
+	}
+	value, set := os.LookupEnv(name)
+	if set {
+		value = getEnv(name)
+	}
+	word := rest[2:]
+	switch rest[1] {
+	case '-':
+		if value == "" {
+			return e.expand(word)
+		}
+		return value
+	case '+':
+		if value != "" {
+			return e.expand(word)
+		}
+		return ""
+	case '?':
+		if value == "" {
+			msg := e.expand(word)
+			if msg == "" {
+				msg = "is required but is unset or empty"
+			}
+			e.problems = append(e.problems, name+": "+msg)
+		}
+		return value
+	}
+	return raw
+}
+
+// variable returns the value of a plain env variable and reports it when it's unset
+func (e *envExpander) variable(raw, name string) string {
+	if _, ok := os.LookupEnv(name); !ok && e.checkUnset {
+		e.problems = append(e.problems, fmt.Sprintf("%s is used as an env variable but is currently unset. Either set it or escape it like so: $%s", raw, raw))
+	}
+	return getEnv(name)
+}
+
+// closingBrace returns the index of the brace closing the ${ expression starting at start, or -1
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// isShellSpecialVar checks if a character is a shell special parameter, like in os.Expand
+func isShellSpecialVar(c byte) bool {
+	return strings.IndexByte("*#@!?-0123456789", c) >= 0
+}
+
+func isEnvNameStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isEnvNameChar(c byte) bool {
+	return isEnvNameStart(c) || ('0' <= c && c <= '9')
+}
+
+// envVarErrors lists, with their file and line, the env variables of a file that are unset or required and missing.
+// Comments are ignored.
+func envVarErrors(s, filename string, checkUnset bool) []string {
+	var errs []string
+	for n, line := range strings.Split(s, "\n") {
+		if !strings.Contains(line, "$") {
+			continue
+		}
+		e := &envExpander{checkUnset: checkUnset}
+		e.expand(stripComment(line))
+		for _, p := range e.problems {
+			errs = append(errs, fmt.Sprintf("%s:%d: %s", filename, n+1, p))
+		}
+	}
+	return errs
+}
+
+// stripComment removes the comment at the end of a line, a # starts a comment
+// when it's at the start of the line or after a space and is not inside a ${...} expression
+func stripComment(line string) string {
+	depth := 0
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '$' && i+1 < len(line) && line[i+1] == '$':
+			i++
+		case line[i] == '$' && i+1 < len(line) && line[i+1] == '{':
+			depth++
+			i++
+		case line[i] == '}' && depth > 0:
+			depth--
+		case line[i] == '#' && depth == 0 && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
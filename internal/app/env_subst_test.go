@@ -0,0 +1,70 @@
+package app
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_envExpander_expand(t *testing.T) {
+	os.Setenv("HELMSMAN_TEST_SET", "value")
+	os.Setenv("HELMSMAN_TEST_EMPTY", "")
+	os.Unsetenv("HELMSMAN_TEST_UNSET")
+	defer os.Unsetenv("HELMSMAN_TEST_SET")
+	defer os.Unsetenv("HELMSMAN_TEST_EMPTY")
+
+	tests := []struct {
+		in       string
+		want     string
+		problems int
+	}{
+		{in: "plain text", want: "plain text"},
+		{in: "$HELMSMAN_TEST_SET and ${HELMSMAN_TEST_SET}", want: "value and value"},
+		{in: "$HELMSMAN_TEST_SET-suffix", want: "value-suffix"},
+		{in: "price: $$5 and $$HELMSMAN_TEST_SET", want: "price: $5 and $HELMSMAN_TEST_SET"},
+		{in: "${HELMSMAN_TEST_UNSET:-default}", want: "default"},
+		{in: "${HELMSMAN_TEST_EMPTY:-default}", want: "default"},
+		{in: "${HELMSMAN_TEST_SET:-default}", want: "value"},
+		{in: "${HELMSMAN_TEST_UNSET:-${HELMSMAN_TEST_SET}}", want: "value"},
+		{in: "${HELMSMAN_TEST_UNSET:-#fff}", want: "#fff"},
+		{in: "${HELMSMAN_TEST_SET:+alt}", want: "alt"},
+		{in: "${HELMSMAN_TEST_EMPTY:+alt}", want: ""},
+		{in: "${HELMSMAN_TEST_SET:?must be set}", want: "value"},
+		{in: "${HELMSMAN_TEST_UNSET:?must be set}", want: "", problems: 1},
+		{in: "$HELMSMAN_TEST_UNSET", want: "", problems: 1},
+		{in: "cost $ 5 and ${unterminated", want: "cost $ 5 and ${unterminated"},
+		{in: "args: $1 $@ ${2} ${#} ${}", want: "args:     "},
+		{in: "$1.50 each", want: ".50 each"},
+	}
+	for _, tt := range tests {
+		e := &envExpander{checkUnset: true}
+		if got := e.expand(tt.in); got != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if len(e.problems) != tt.problems {
+			t.Errorf("expand(%q) problems = %v, want %d", tt.in, e.problems, tt.problems)
+		}
+	}
+}
+
+func Test_envVarErrors(t *testing.T) {
+	os.Unsetenv("HELMSMAN_TEST_UNSET")
+	os.Unsetenv("HELMSMAN_TEST_TOKEN")
+	s := "settings:\n" +
+		"  # $HELMSMAN_TEST_UNSET in a comment\n" +
+		"  kubeContext: $HELMSMAN_TEST_UNSET # trailing $HELMSMAN_TEST_UNSET\n" +
+		"  color: \"${HELMSMAN_TEST_UNSET:-#fff}\"\n" +
+		"  token: ${HELMSMAN_TEST_TOKEN:?the deploy token}\n"
+
+	want := []string{
+		"dsf.yaml:3: $HELMSMAN_TEST_UNSET is used as an env variable but is currently unset. Either set it or escape it like so: $$HELMSMAN_TEST_UNSET",
+		"dsf.yaml:5: HELMSMAN_TEST_TOKEN: the deploy token",
+	}
+	if got := envVarErrors(s, "dsf.yaml", true); !reflect.DeepEqual(got, want) {
+		t.Errorf("envVarErrors() = %q, want %q", got, want)
+	}
+	want = want[1:]
+	if got := envVarErrors(s, "dsf.yaml", false); !reflect.DeepEqual(got, want) {
+		t.Errorf("envVarErrors() without checking unset variables = %q, want %q", got, want)
+	}
+}
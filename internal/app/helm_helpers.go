@@ -19,8 +19,11 @@ type helmRepo struct {
 }
 
 type ChartInfo struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Dependencies []chartDependency `json:"dependencies,omitempty"`
+	values       map[string]interface{}
+	schema       []byte
 }
 
 // helmCmd prepares a helm command to be executed
@@ -54,21 +57,26 @@ func getChartInfo(chartName, chartVersion string) (*ChartInfo, error) {
 	if err := yaml.Unmarshal([]byte(res.output), &c); err != nil {
 		log.Fatal(fmt.Sprint(err))
 	}
+	if err := c.matchVersion(chartName, chartVersion); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
+// matchVersion checks that the version of the chart that was found matches the requested version constraint
+func (c *ChartInfo) matchVersion(chartName, chartVersion string) error {
 	constraint, err := semver.NewConstraint(chartVersion)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	found, err := semver.NewVersion(c.Version)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
 	if !constraint.Check(found) {
-		return nil, fmt.Errorf("chart [ %s ] with version [ %s ] was found with a mismatched version: %s", chartName, chartVersion, c.Version)
+		return fmt.Errorf("chart [ %s ] with version [ %s ] was found with a mismatched version: %s", chartName, chartVersion, c.Version)
 	}
-
-	return c, nil
+	return nil
 }
 
 // getHelmClientVersion returns Helm client Version
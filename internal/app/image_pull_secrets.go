@@ -0,0 +1,202 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	dockerConfigJSONKey  = ".dockerconfigjson"
+	dockerConfigJSONType = "kubernetes.io/dockerconfigjson"
+)
+
+// ImagePullSecret type represents a docker-registry secret Helmsman manages in a namespace.
+// Its content comes from exactly one source: registry credentials, a docker config JSON, a docker config file
+// or another secret of the cluster.
+type ImagePullSecret struct {
+	// Registry is the server of the registry, e.g. ghcr.io
+	Registry string `json:"registry,omitempty"`
+	// Username to log in to the registry
+	Username string `json:"username,omitempty"`
+	// Password to log in to the registry, e.g. from an env variable or a secret reference
+	Password string `json:"password,omitempty"`
+	// Email of the registry account
+	Email string `json:"email,omitempty"`
+	// DockerConfigJSON is the content of a docker config JSON file, e.g. from an env variable or a secret reference
+	DockerConfigJSON string `json:"dockerConfigJson,omitempty"`
+	// File is the path of a docker config JSON file
+	File string `json:"file,omitempty"`
+	// CopyFrom is a docker-registry secret to copy, as namespace/name
+	CopyFrom string `json:"copyFrom,omitempty"`
+	// PatchDefaultServiceAccount adds the secret to the imagePullSecrets of the default ServiceAccount of the namespace
+	PatchDefaultServiceAccount bool `json:"patchDefaultServiceAccount,omitempty"`
+}
+
+// validate validates that the secret has exactly one source
+func (ips *ImagePullSecret) validate() error {
+	if ips == nil {
+		return errors.New("it is empty")
+	}
+	sources := 0
+	for _, set := range []bool{ips.Registry != "" || ips.Username != "" || ips.Password != "", ips.DockerConfigJSON != "", ips.File != "", ips.CopyFrom != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("it needs exactly one of registry credentials, dockerConfigJson, file or copyFrom")
+	}
+	if (ips.Registry != "" || ips.Username != "" || ips.Password != "") && (ips.Registry == "" || ips.Username == "" || ips.Password == "") {
+		return errors.New("registry credentials need a registry, a username and a password")
+	}
+	if ips.File != "" {
+		if _, err := os.Stat(ips.File); err != nil {
+			return fmt.Errorf("file [ %s ] can't be read: %w", ips.File, err)
+		}
+	}
+	if ips.CopyFrom != "" {
+		if ns, name, found := strings.Cut(ips.CopyFrom, "/"); !found || ns == "" || name == "" {
+			return fmt.Errorf("copyFrom [ %s ] should be namespace/name", ips.CopyFrom)
+		}
+	}
+	return nil
+}
+
+// dockerConfigJSON returns the content of the docker config JSON of the secret, read from its source
+func (ips *ImagePullSecret) dockerConfigJSON() (string, error) {
+	switch {
+	case ips.DockerConfigJSON != "":
+		return ips.DockerConfigJSON, nil
+	case ips.File != "":
+		data, err := os.ReadFile(ips.File)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case ips.CopyFrom != "":
+		ns, name, _ := strings.Cut(ips.CopyFrom, "/")
+		return getDockerConfigJSON(ns, name)
+	default:
+		auth := map[string]string{
+			"username": ips.Username,
+			"password": ips.Password,
+			"auth":     base64.StdEncoding.EncodeToString([]byte(ips.Username + ":" + ips.Password)),
+		}
+		if ips.Email != "" {
+			auth["email"] = ips.Email
+		}
+		data, err := json.Marshal(map[string]interface{}{"auths": map[string]interface{}{ips.Registry: auth}})
+		return string(data), err
+	}
+}
+
+// getDockerConfigJSON returns the docker config JSON of a docker-registry secret of the cluster
+func getDockerConfigJSON(ns, name string) (string, error) {
+	cmd := kubectl([]string{"get", "secret", name, "--namespace", ns, "--output", "json"}, "Getting secret [ "+name+" ] in namespace [ "+ns+" ]")
+	res, err := cmd.Exec()
+	if err != nil {
+		return "", err
+	}
+	var secret struct {
+		Type string            `json:"type"`
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(res.output), &secret); err != nil {
+		return "", err
+	}
+	if secret.Type != dockerConfigJSONType {
+		return "", fmt.Errorf("secret [ %s/%s ] is of type [ %s ], not %s", ns, name, secret.Type, dockerConfigJSONType)
+	}
+	value, err := base64.StdEncoding.DecodeString(secret.Data[dockerConfigJSONKey])
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// imagePullSecretObjects returns the desired docker-registry Secrets of a namespace.
+// The credentials are redacted from the output.
+func imagePullSecretObjects(ns string, secrets map[string]*ImagePullSecret) ([]namespaceObject, error) {
+	var objects []namespaceObject
+	for _, name := range sortedKeys(secrets) {
+		config, err := secrets[name].dockerConfigJSON()
+		if err != nil {
+			return nil, fmt.Errorf("can't read image pull secret [ %s ] of namespace [ %s ]: %w", name, ns, err)
+		}
+		if !json.Valid([]byte(config)) {
+			return nil, fmt.Errorf("image pull secret [ %s ] of namespace [ %s ] is not a valid docker config JSON", name, ns)
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(config))
+		redactions.add(config, encoded, secrets[name].Password)
+		obj := newNamespaceObject("v1", "Secret", ns, name, map[string]interface{}{
+			"type": dockerConfigJSONType,
+			"data": map[string]interface{}{dockerConfigJSONKey: encoded},
+		})
+		obj["metadata"].(map[string]interface{})["labels"] = ownedLabels("secret")
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// planDefaultServiceAccount adds to the plan the update of the default ServiceAccount of a namespace,
+// when some image pull secrets patch it and are not in its imagePullSecrets yet
+func planDefaultServiceAccount(p *plan, ns string, secrets map[string]*ImagePullSecret, priority int) error {
+	var patched []string
+	for _, name := range sortedKeys(secrets) {
+		if secrets[name].PatchDefaultServiceAccount {
+			patched = append(patched, name)
+		}
+	}
+	if len(patched) == 0 {
+		return nil
+	}
+	cmd := kubectl([]string{"get", "serviceaccount", "default", "--namespace", ns, "--ignore-not-found", "--output", "json"},
+		"Getting the default ServiceAccount of namespace [ "+ns+" ]")
+	res, err := cmd.Exec()
+	if err != nil {
+		return err
+	}
+	var sa struct {
+		ImagePullSecrets []map[string]interface{} `json:"imagePullSecrets"`
+	}
+	if strings.TrimSpace(res.output) != "" {
+		if err := json.Unmarshal([]byte(res.output), &sa); err != nil {
+			return fmt.Errorf("failed to unmarshal the default ServiceAccount of namespace [ %s ]: %w", ns, err)
+		}
+	}
+	refs, missing := mergeImagePullSecrets(sa.ImagePullSecrets, patched)
+	if len(missing) == 0 {
+		return nil
+	}
+	obj := namespaceObject{
+		"apiVersion":       "v1",
+		"kind":             "ServiceAccount",
+		"metadata":         map[string]interface{}{"name": "default", "namespace": ns},
+		"imagePullSecrets": refs,
+	}
+	return planApply(p, ns, obj, "updated to use the image pull secrets "+strings.Join(missing, ", "), change, priority)
+}
+
+// mergeImagePullSecrets adds the names of secrets to the imagePullSecrets of a ServiceAccount, and returns the ones that were missing
+func mergeImagePullSecrets(current []map[string]interface{}, names []string) ([]map[string]interface{}, []string) {
+	refs := append([]map[string]interface{}(nil), current...)
+	var missing []string
+	for _, name := range names {
+		found := false
+		for _, ref := range current {
+			if ref["name"] == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			refs = append(refs, map[string]interface{}{"name": name})
+			missing = append(missing, name)
+		}
+	}
+	return refs, missing
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ImagePullSecret_validate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(`{"auths":{}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		ips     *ImagePullSecret
+		wantErr bool
+	}{
+		{name: "credentials", ips: &ImagePullSecret{Registry: "ghcr.io", Username: "ci", Password: "s3cr3t"}},
+		{name: "docker config", ips: &ImagePullSecret{DockerConfigJSON: `{"auths":{}}`}},
+		{name: "file", ips: &ImagePullSecret{File: file}},
+		{name: "copy", ips: &ImagePullSecret{CopyFrom: "ci/regcred", PatchDefaultServiceAccount: true}},
+		{name: "empty", ips: &ImagePullSecret{}, wantErr: true},
+		{name: "nil", ips: nil, wantErr: true},
+		{name: "two sources", ips: &ImagePullSecret{File: file, CopyFrom: "ci/regcred"}, wantErr: true},
+		{name: "missing password", ips: &ImagePullSecret{Registry: "ghcr.io", Username: "ci"}, wantErr: true},
+		{name: "missing file", ips: &ImagePullSecret{File: "missing.json"}, wantErr: true},
+		{name: "invalid copy", ips: &ImagePullSecret{CopyFrom: "regcred"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.ips.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_imagePullSecretObjects(t *testing.T) {
+	curContext = "test-ctx"
+	defer redactions.reset()
+	secrets := map[string]*ImagePullSecret{
+		"ghcr":   {Registry: "ghcr.io", Username: "ci", Password: "s3cr3t-token"},
+		"inline": {DockerConfigJSON: `{"auths":{"quay.io":{"auth":"abcd"}}}`},
+	}
+	objects, err := imagePullSecretObjects("staging", secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].name() != "ghcr" || objects[1].name() != "inline" {
+		t.Fatalf("imagePullSecretObjects() = %v, want the ghcr and inline secrets", objects)
+	}
+	obj := objects[0]
+	if obj["type"] != dockerConfigJSONType {
+		t.Errorf("imagePullSecretObjects() type = %v, want %s", obj["type"], dockerConfigJSONType)
+	}
+	wantLabels := map[string]string{"HELMSMAN_IMAGE_PULL_SECRET": "true", "HELMSMAN_CONTEXT": "test-ctx"}
+	if labels := obj["metadata"].(map[string]interface{})["labels"]; !reflect.DeepEqual(labels, wantLabels) {
+		t.Errorf("imagePullSecretObjects() labels = %v, want %v", labels, wantLabels)
+	}
+	encoded := obj["data"].(map[string]interface{})[dockerConfigJSONKey].(string)
+	config, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte("ci:s3cr3t-token"))
+	want := `{"auths":{"ghcr.io":{"auth":"` + auth + `","password":"s3cr3t-token","username":"ci"}}}`
+	if string(config) != want {
+		t.Errorf("imagePullSecretObjects() config = %s, want %s", config, want)
+	}
+	if out := redactions.redact("password s3cr3t-token data " + encoded); strings.Contains(out, "s3cr3t-token") || strings.Contains(out, encoded) {
+		t.Errorf("imagePullSecretObjects() didn't register the credentials for redaction: %s", out)
+	}
+
+	if _, err := imagePullSecretObjects("staging", map[string]*ImagePullSecret{"bad": {DockerConfigJSON: "not json"}}); err == nil {
+		t.Errorf("imagePullSecretObjects() error = nil, want an error for an invalid docker config JSON")
+	}
+}
+
+func Test_mergeImagePullSecrets(t *testing.T) {
+	current := []map[string]interface{}{{"name": "legacy"}, {"name": "ghcr"}}
+	refs, missing := mergeImagePullSecrets(current, []string{"ghcr", "quay"})
+	wantRefs := []map[string]interface{}{{"name": "legacy"}, {"name": "ghcr"}, {"name": "quay"}}
+	if !reflect.DeepEqual(refs, wantRefs) || !reflect.DeepEqual(missing, []string{"quay"}) {
+		t.Errorf("mergeImagePullSecrets() = %v, %v, want %v, [quay]", refs, missing, wantRefs)
+	}
+	if _, missing := mergeImagePullSecrets(current, []string{"ghcr"}); len(missing) != 0 {
+		t.Errorf("mergeImagePullSecrets() missing = %v, want none", missing)
+	}
+}
+
+func Test_ownedLabelSelector(t *testing.T) {
+	curContext = "test-ctx"
+	if got := ownedLabelSelector("limitrange"); got != "MANAGED-BY=HELMSMAN,HELMSMAN_CONTEXT=test-ctx" {
+		t.Errorf("ownedLabelSelector(limitrange) = %s", got)
+	}
+	// secrets labelled MANAGED-BY=HELMSMAN are helm releases
+	if got := ownedLabelSelector("secret"); got != "HELMSMAN_IMAGE_PULL_SECRET=true,HELMSMAN_CONTEXT=test-ctx" {
+		t.Errorf("ownedLabelSelector(secret) = %s", got)
+	}
+}
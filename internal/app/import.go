@@ -0,0 +1,237 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	importCommand   = "import"
+	importValuesDir = "values"
+)
+
+// chartSearchResult is a single entry of the `helm search repo -o json` output
+type chartSearchResult struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// importedApp holds what is needed to describe an existing helm release in a desired state file
+type importedApp struct {
+	release    helmRelease
+	chart      string
+	repo       string
+	valuesFile string
+}
+
+// importReleases generates a desired state file, and a values file per release,
+// from the helm releases already running in the given namespaces (all namespaces if none are given).
+func importReleases(namespaces []string, output, context string, label bool) error {
+	releases, err := listHelmReleases(namespaces)
+	if err != nil {
+		return err
+	}
+	if len(releases) == 0 {
+		log.Info("No helm releases found to import.")
+		return nil
+	}
+
+	repos := make(map[string]string)
+	cmd := helmCmd([]string{"repo", "list", "--output", "json"}, "Listing helm repositories")
+	if res, err := cmd.Exec(); err == nil {
+		var helmRepos []helmRepo
+		if err := json.Unmarshal([]byte(res.output), &helmRepos); err != nil {
+			return fmt.Errorf("failed to unmarshal Helm CLI output: %w", err)
+		}
+		for _, repo := range helmRepos {
+			repos[repo.Name] = repo.URL
+		}
+	}
+
+	dir := filepath.Dir(output)
+	var apps []importedApp
+	for _, r := range releases {
+		if r.Status == helmStatusUninstalled || r.Status == helmStatusUninstalling {
+			log.Verbose("Skipping release [ " + r.Name + " ] in namespace [ " + r.Namespace + " ] with status [ " + r.Status + " ]")
+			continue
+		}
+		app := importedApp{release: r, chart: r.getChartName()}
+		if repo := findChartRepo(app.chart, r.getChartVersion(), repos); repo != "" {
+			app.repo = repo
+			app.chart = repo + "/" + app.chart
+		} else {
+			log.Warning("Could not find the repository of chart [ " + r.Chart + " ] used by release [ " + r.Name + " ] in namespace [ " + r.Namespace + " ]. Set its chart manually.")
+		}
+
+		app.valuesFile = filepath.Join(importValuesDir, r.Namespace, r.Name+".yaml")
+		if err := writeReleaseValues(r, filepath.Join(dir, app.valuesFile)); err != nil {
+			return err
+		}
+		apps = append(apps, app)
+	}
+
+	storageBackend := helmStorageBackend()
+	if err := writeStateMap(output, importedState(apps, context, storageBackend, repos)); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("Imported [ %d ] releases into [ %s ]", len(apps), output))
+
+	if label {
+		if !isLabelledStorageBackend(storageBackend) {
+			return fmt.Errorf("releases stored in the [ %s ] helm storage backend can't be labelled", storageBackend)
+		}
+		curContext = context
+		for _, app := range apps {
+			r := &Release{Name: app.release.Name, Namespace: app.release.Namespace, Enabled: NullBool{HasValue: true, Value: true}}
+			r.mark(storageBackend)
+		}
+		log.Info("Labelled the imported releases with context [ " + context + " ]")
+	}
+	return nil
+}
+
+// helmStorageBackend returns the storage backend of the helm releases, set with HELM_DRIVER like for helm
+func helmStorageBackend() string {
+	if driver := os.Getenv("HELM_DRIVER"); driver != "" {
+		return driver
+	}
+	return defaultStorageBackend
+}
+
+// isLabelledStorageBackend checks if helm stores releases in k8s objects that Helmsman can label
+func isLabelledStorageBackend(storageBackend string) bool {
+	return stringInSlice(storageBackend, []string{"secret", "secrets", "configmap", "configmaps"})
+}
+
+// listHelmReleases lists all helm releases in the given namespaces, or in all namespaces if none are given
+func listHelmReleases(namespaces []string) ([]helmRelease, error) {
+	var all []helmRelease
+	args := []string{"list", "--all", "--max", "0", "--output", "json"}
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	for _, ns := range namespaces {
+		nsArgs := []string{"--all-namespaces"}
+		desc := "Listing all existing releases in all namespaces"
+		if ns != "" {
+			nsArgs = []string{"-n", ns}
+			desc = "Listing all existing releases in [ " + ns + " ] namespace"
+		}
+		cmd := helmCmd(concat(args, nsArgs), desc)
+		res, err := cmd.RetryExec(3)
+		if err != nil {
+			return nil, err
+		}
+		var releases []helmRelease
+		if err := json.Unmarshal([]byte(res.output), &releases); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal Helm CLI output: %w", err)
+		}
+		all = append(all, releases...)
+	}
+	return all, nil
+}
+
+// findChartRepo looks up the local helm repositories for one providing the given chart version.
+// It returns an empty string if no repository could be found.
+func findChartRepo(chart, version string, repos map[string]string) string {
+	if len(repos) == 0 || chart == "" {
+		return ""
+	}
+	cmd := helmCmd([]string{"search", "repo", chart, "--versions", "--output", "json"}, "Searching repositories for chart [ "+chart+" ]")
+	res, err := cmd.Exec()
+	if err != nil {
+		return ""
+	}
+	var results []chartSearchResult
+	if err := json.Unmarshal([]byte(res.output), &results); err != nil {
+		return ""
+	}
+	var found []string
+	for _, c := range results {
+		repo, name, ok := strings.Cut(c.Name, "/")
+		if !ok || name != chart || c.Version != version {
+			continue
+		}
+		if _, ok := repos[repo]; ok && !stringInSlice(repo, found) {
+			found = append(found, repo)
+		}
+	}
+	if len(found) == 0 {
+		return ""
+	}
+	sort.Strings(found)
+	if len(found) > 1 {
+		log.Warning("Chart [ " + chart + " ] version [ " + version + " ] is provided by repositories [ " + strings.Join(found, ", ") + " ]. Using [ " + found[0] + " ]")
+	}
+	return found[0]
+}
+
+// writeReleaseValues writes the user-supplied values of a helm release to a file
+func writeReleaseValues(r helmRelease, file string) error {
+	cmd := helmCmd([]string{"get", "values", r.Name, "-n", r.Namespace, "--output", "yaml"}, "Getting user-supplied values of release [ "+r.Name+" ] in namespace [ "+r.Namespace+" ]")
+	res, err := cmd.Exec()
+	if err != nil {
+		return err
+	}
+	values := res.output
+	if strings.TrimSpace(values) == "null" {
+		values = "{}"
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(strings.TrimSpace(values)+"\n"), 0o644)
+}
+
+// importedState builds the desired state map describing the imported releases
+func importedState(apps []importedApp, context, storageBackend string, repos map[string]string) map[string]interface{} {
+	names := make(map[string]int)
+	for _, app := range apps {
+		names[app.release.Name]++
+	}
+
+	helmRepos := make(map[string]interface{})
+	namespaces := make(map[string]interface{})
+	releases := make(map[string]interface{})
+	for _, app := range apps {
+		r := app.release
+		if app.repo != "" {
+			helmRepos[app.repo] = repos[app.repo]
+		}
+		namespaces[r.Namespace] = map[string]interface{}{}
+
+		release := map[string]interface{}{
+			"namespace":  r.Namespace,
+			"enabled":    true,
+			"chart":      app.chart,
+			"version":    r.getChartVersion(),
+			"valuesFile": filepath.ToSlash(app.valuesFile),
+		}
+		// releases with the same name in different namespaces need distinct app names
+		key := r.Name
+		if names[r.Name] > 1 {
+			key = r.key()
+			release["name"] = r.Name
+		}
+		releases[key] = release
+	}
+
+	m := map[string]interface{}{
+		"namespaces": namespaces,
+		"apps":       releases,
+	}
+	if context != "" && context != defaultContextName {
+		m["context"] = context
+	}
+	if len(helmRepos) > 0 {
+		m["helmRepos"] = helmRepos
+	}
+	if storageBackend != defaultStorageBackend {
+		m["settings"] = map[string]interface{}{"storageBackend": storageBackend}
+	}
+	return m
+}
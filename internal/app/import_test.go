@@ -0,0 +1,73 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_importedState(t *testing.T) {
+	repos := map[string]string{"bitnami": "https://charts.bitnami.com/bitnami", "unused": "https://example.com"}
+	apps := []importedApp{
+		{
+			release:    helmRelease{Name: "nginx", Namespace: "staging", Chart: "nginx-15.1.0"},
+			chart:      "bitnami/nginx",
+			repo:       "bitnami",
+			valuesFile: "values/staging/nginx.yaml",
+		}, {
+			release:    helmRelease{Name: "nginx", Namespace: "production", Chart: "nginx-15.0.0"},
+			chart:      "bitnami/nginx",
+			repo:       "bitnami",
+			valuesFile: "values/production/nginx.yaml",
+		}, {
+			release:    helmRelease{Name: "internal", Namespace: "production", Chart: "internal-1.0.0"},
+			chart:      "internal",
+			valuesFile: "values/production/internal.yaml",
+		},
+	}
+	want := map[string]interface{}{
+		"context":   "prod-cluster",
+		"helmRepos": map[string]interface{}{"bitnami": "https://charts.bitnami.com/bitnami"},
+		"namespaces": map[string]interface{}{
+			"staging":    map[string]interface{}{},
+			"production": map[string]interface{}{},
+		},
+		"apps": map[string]interface{}{
+			"nginx-staging": map[string]interface{}{
+				"name": "nginx", "namespace": "staging", "enabled": true, "chart": "bitnami/nginx",
+				"version": "15.1.0", "valuesFile": "values/staging/nginx.yaml",
+			},
+			"nginx-production": map[string]interface{}{
+				"name": "nginx", "namespace": "production", "enabled": true, "chart": "bitnami/nginx",
+				"version": "15.0.0", "valuesFile": "values/production/nginx.yaml",
+			},
+			"internal": map[string]interface{}{
+				"namespace": "production", "enabled": true, "chart": "internal",
+				"version": "1.0.0", "valuesFile": "values/production/internal.yaml",
+			},
+		},
+	}
+	if got := importedState(apps, "prod-cluster", defaultStorageBackend, repos); !reflect.DeepEqual(got, want) {
+		t.Errorf("importedState() = %v, want %v", got, want)
+	}
+}
+
+func Test_importedState_storageBackend(t *testing.T) {
+	got := importedState(nil, defaultContextName, "configmap", nil)
+	if want := map[string]interface{}{"storageBackend": "configmap"}; !reflect.DeepEqual(got["settings"], want) {
+		t.Errorf("importedState() settings = %v, want %v", got["settings"], want)
+	}
+}
+
+func Test_helmStorageBackend(t *testing.T) {
+	t.Setenv("HELM_DRIVER", "")
+	if got := helmStorageBackend(); got != defaultStorageBackend {
+		t.Errorf("helmStorageBackend() = %s, want %s", got, defaultStorageBackend)
+	}
+	t.Setenv("HELM_DRIVER", "configmap")
+	if got := helmStorageBackend(); got != "configmap" {
+		t.Errorf("helmStorageBackend() = %s, want configmap", got)
+	}
+	if isLabelledStorageBackend("sql") {
+		t.Errorf("isLabelledStorageBackend(sql) = true, want false")
+	}
+}
@@ -4,38 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"strings"
-	"sync"
-
-	"sigs.k8s.io/yaml"
 )
 
-// addNamespaces creates a set of namespaces in your k8s cluster.
-// If a namespace with the same name exists, it will skip it.
-// If --ns-override flag is used, it only creates the provided namespace in that flag
-func addNamespaces(s *State) {
-	var wg sync.WaitGroup
-	for nsName, ns := range s.Namespaces {
-		if ns.disabled {
-			continue
-		}
-		wg.Add(1)
-		go func(name string, cfg *Namespace, wg *sync.WaitGroup) {
-			defer wg.Done()
-			createNamespace(name, cfg.Labels, cfg.Annotations)
-			labelNamespace(name, cfg.Labels, s.Settings.NamespaceLabelsAuthoritative)
-			annotateNamespace(name, cfg.Annotations)
-			if !flags.dryRun {
-				setLimits(name, cfg.Limits)
-				setQuotas(name, cfg.Quotas)
-			}
-		}(nsName, ns, &wg)
-	}
-	wg.Wait()
-}
-
 // kubectl prepares a kubectl command to be executed
 func kubectl(args []string, desc string) Command {
 	return Command{
@@ -45,196 +16,116 @@ func kubectl(args []string, desc string) Command {
 	}
 }
 
-// createNamespace creates a namespace in the k8s cluster
-func createNamespace(ns string, labels map[string]string, annotations map[string]string) {
-	checkCmd := kubectl([]string{"get", "namespace", ns}, "Looking for namespace [ "+ns+" ]")
-	if _, err := checkCmd.Exec(); err == nil {
-		log.Verbose("Namespace [ " + ns + " ] exists")
-		return
+// namespaceManifest builds the manifest of a Namespace object
+func namespaceManifest(ns string, labels, annotations map[string]string) namespaceObject {
+	metadata := map[string]interface{}{"name": ns}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
 	}
-
-	targetFile, err := tempBuildNamespaceDefinition(ns, labels, annotations)
-	if err != nil {
-		log.Fatal(err.Error())
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
 	}
-	defer os.Remove(targetFile.Name())
-
-	cmd := kubectl([]string{"apply", "-f", targetFile.Name(), flags.getKubeDryRunFlag("apply")},
-		"Creating namespace [ "+ns+" ]")
-
-	if _, err := cmd.Exec(); err != nil {
-		log.Fatalf("Failed creating namespace [ "+ns+" ] with error: %v", err)
-	}
-	log.Info("Namespace [ " + ns + " ] created")
+	return namespaceObject{"apiVersion": "v1", "kind": "Namespace", "metadata": metadata}
 }
 
-// tempBuildNamespaceDefinition creates temporary file with Namespace object definition
-func tempBuildNamespaceDefinition(ns string, labels map[string]string, annotations map[string]string) (f *os.File, err error) {
-	definition := `
----
-apiVersion: v1
-kind: Namespace
-metadata:
-`
-	definition += fmt.Sprintf("  name: \"%s\"\n", ns)
-
-	metadata := make(map[string]map[string]string)
-	metadata["labels"] = labels
-	metadata["annotations"] = annotations
-	d, err := yaml.Marshal(&metadata)
+// getNamespaceMetadata returns the labels and annotations of a namespace, exists is false when the namespace doesn't exist
+func getNamespaceMetadata(ns string) (labels, annotations map[string]string, exists bool, err error) {
+	cmd := kubectl([]string{"get", "namespace", ns, "--ignore-not-found", "-o", "json"}, "Looking for namespace [ "+ns+" ]")
+	res, err := cmd.Exec()
 	if err != nil {
-		return nil, err
+		return nil, nil, false, fmt.Errorf("error getting namespace [ %s ]: %w", ns, err)
 	}
-	definition += Indent(string(d), strings.Repeat(" ", 2))
-
-	targetFile, err := ioutil.TempFile(tempFilesDir, "namespace-*.yaml")
-	if err != nil {
-		return nil, err
+	if strings.TrimSpace(res.output) == "" {
+		return nil, nil, false, nil
 	}
-
-	if _, err = targetFile.Write([]byte(definition)); err != nil {
-		return nil, err
+	var obj struct {
+		Metadata struct {
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
 	}
-
-	return targetFile, nil
+	if err := json.Unmarshal([]byte(res.output), &obj); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to unmarshal kubectl get namespace [ %s ] output: %w", ns, err)
+	}
+	return obj.Metadata.Labels, obj.Metadata.Annotations, true, nil
 }
 
-// labelNamespace labels a namespace with provided labels
-func labelNamespace(ns string, labels map[string]string, authoritative bool) {
-	var nsLabels map[string]string
-
-	args := []string{"label", "--overwrite", "namespace/" + ns, flags.getKubeDryRunFlag("label")}
-
-	if authoritative {
-		cmdGetLabels := kubectl([]string{"get", "namespace", ns, "-o", "jsonpath='{.metadata.labels}'"}, "Getting namespace [ "+ns+" ] current labels")
-		res, err := cmdGetLabels.Exec()
-		if err != nil {
-			log.Error(fmt.Sprintf("Could not get namespace [ %s ] labels. Error message: %v", ns, err))
-		}
-		if err := json.Unmarshal([]byte(strings.Trim(res.output, `'`)), &nsLabels); err != nil {
-			log.Fatal(fmt.Sprintf("failed to unmarshal kubectl get namespace labels output: %s, ended with error: %s", res.output, err))
-		}
-		// ignore default k8s namespace label from being removed
-		delete(nsLabels, "kubernetes.io/metadata.name")
-		// ignore every label defined in DSF for the namespace from being removed
-		for definedLabelKey := range labels {
-			delete(nsLabels, definedLabelKey)
-		}
-		for label := range nsLabels {
-			args = append(args, label+"-")
+// metadataChanges returns the kubectl label or annotate arguments that make the current labels, or annotations, match the desired ones.
+// When authoritative, the current ones that are not desired are removed, except the ones set by k8s and Helmsman.
+func metadataChanges(desired, current map[string]string, authoritative bool) []string {
+	var args []string
+	for _, k := range sortedKeys(desired) {
+		if v, ok := current[k]; !ok || v != desired[k] {
+			args = append(args, k+"="+desired[k])
 		}
 	}
-	if len(labels) == 0 && len(nsLabels) == 0 {
-		return
+	if authoritative {
+		for _, k := range sortedKeys(current) {
+			if _, ok := desired[k]; ok || k == "kubernetes.io/metadata.name" || isHelmsmanNamespaceLabel(k) {
+				continue
+			}
+			args = append(args, k+"-")
+		}
 	}
+	return args
+}
 
-	for k, v := range labels {
-		args = append(args, k+"="+v)
+// planNamespace adds to the plan the creation of a namespace when it doesn't exist, or the changes of its labels and annotations.
+// A nil ns is a namespace that is not defined in the DSF, e.g. the --ns-override one, which is only created.
+// It returns whether the namespace exists.
+func (s *State) planNamespace(p *plan, name string, ns *Namespace, priority int) (bool, error) {
+	labels, annotations, exists, err := getNamespaceMetadata(name)
+	if err != nil {
+		return false, err
 	}
-	cmd := kubectl(args, "Labeling namespace [ "+ns+" ]")
-
-	if _, err := cmd.Exec(); err != nil && flags.verbose {
-		log.Warning(fmt.Sprintf("Could not label namespace [ %s with %v ]. Error message: %v", ns, strings.Join(args[4:], ","), err))
+	var desiredLabels, desiredAnnotations, createdLabels map[string]string
+	if ns != nil {
+		desiredLabels, desiredAnnotations = s.namespaceLabels(ns), ns.Annotations
+		createdLabels = createdNamespaceLabels(desiredLabels)
 	}
-}
 
-// annotateNamespace annotates a namespace with provided annotations
-func annotateNamespace(ns string, annotations map[string]string) {
-	if len(annotations) == 0 {
-		return
+	if !exists {
+		file, err := writeManifest(namespaceManifest(name, createdLabels, desiredAnnotations))
+		if err != nil {
+			return false, err
+		}
+		p.addDecision("Namespace [ "+name+" ] will be created", priority, create)
+		p.addCommand(kubectl([]string{"apply", "-f", file, flags.getKubeDryRunFlag("apply")},
+			"Creating namespace [ "+name+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
+		return false, nil
 	}
 
-	args := []string{"annotate", "--overwrite", "namespace/" + ns, flags.getKubeDryRunFlag("annotate")}
-	for k, v := range annotations {
-		args = append(args, k+"="+v)
+	if args := metadataChanges(desiredLabels, labels, ns != nil && s.Settings.NamespaceLabelsAuthoritative); len(args) > 0 {
+		p.addDecision("Labels of namespace [ "+name+" ] will be changed: "+strings.Join(args, " "), priority, change)
+		p.addCommand(kubectl(concat([]string{"label", "--overwrite", "namespace/" + name}, args, []string{flags.getKubeDryRunFlag("label")}),
+			"Labeling namespace [ "+name+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
 	}
-	cmd := kubectl(args, "Annotating namespace [ "+ns+" ]")
-
-	if _, err := cmd.Exec(); err != nil && flags.verbose {
-		log.Info(fmt.Sprintf("Could not annotate namespace [ %s with %v ]. Error message: %v", ns, strings.Join(args[4:], ","), err))
+	if args := metadataChanges(desiredAnnotations, annotations, false); len(args) > 0 {
+		p.addDecision("Annotations of namespace [ "+name+" ] will be changed: "+strings.Join(args, " "), priority, change)
+		p.addCommand(kubectl(concat([]string{"annotate", "--overwrite", "namespace/" + name}, args, []string{flags.getKubeDryRunFlag("annotate")}),
+			"Annotating namespace [ "+name+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
 	}
+	return true, nil
 }
 
-// setLimits creates a LimitRange resource in the provided Namespace
-func setLimits(ns string, lims Limits) {
+// limitRangeObjects returns the LimitRange object of a namespace, if it has limits
+func limitRangeObjects(ns string, lims Limits) []namespaceObject {
 	if len(lims) == 0 {
-		return
-	}
-
-	definition := `
----
-apiVersion: v1
-kind: LimitRange
-metadata:
-  name: limit-range
-spec:
-  limits:
-`
-	d, err := yaml.Marshal(&lims)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-
-	definition += Indent(string(d), strings.Repeat(" ", 4))
-
-	if err := apply(definition, ns, "LimitRange"); err != nil {
-		log.Fatal(err.Error())
+		return nil
 	}
+	return []namespaceObject{newNamespaceObject("v1", "LimitRange", ns, "limit-range", map[string]interface{}{
+		"spec": map[string]interface{}{"limits": lims},
+	})}
 }
 
-func setQuotas(ns string, quotas *Quotas) {
+// resourceQuotaObjects returns the ResourceQuota object of a namespace, if it has quotas
+func resourceQuotaObjects(ns string, quotas *Quotas) []namespaceObject {
 	if quotas == nil {
-		return
-	}
-
-	definition := `
----
-apiVersion: v1
-kind: ResourceQuota
-metadata:
-  name: resource-quota
-spec:
-  hard:
-`
-
-	for _, customQuota := range quotas.CustomQuotas {
-		definition += Indent(customQuota.Name+": '"+customQuota.Value+"'\n", strings.Repeat(" ", 4))
-	}
-
-	// Special formatting for custom quotas so manually write these and then set to nil for marshalling
-	quotas.CustomQuotas = nil
-
-	d, err := yaml.Marshal(&quotas)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-
-	definition += Indent(string(d), strings.Repeat(" ", 4))
-
-	if err := apply(definition, ns, "ResourceQuota"); err != nil {
-		log.Fatal(err.Error())
-	}
-}
-
-func apply(definition, ns, kind string) error {
-	targetFile, err := ioutil.TempFile(tempFilesDir, kind+"-*.yaml")
-	if err != nil {
-		return err
-	}
-	defer os.Remove(targetFile.Name())
-
-	if _, err = targetFile.Write([]byte(definition)); err != nil {
-		return err
-	}
-
-	cmd := kubectl([]string{"apply", "-f", targetFile.Name(), "-n", ns, flags.getKubeDryRunFlag("apply")},
-		"Creating "+kind+" in namespace [ "+ns+" ]")
-
-	if _, err := cmd.Exec(); err != nil {
-		return fmt.Errorf("error creating %s in namespace [ %s ]: %w", kind, ns, err)
+		return nil
 	}
-
-	return nil
+	return []namespaceObject{newNamespaceObject("v1", "ResourceQuota", ns, "resource-quota", map[string]interface{}{
+		"spec": map[string]interface{}{"hard": quotas.hard()},
+	})}
 }
 
 // createContext creates a context -connecting to a k8s cluster- in kubectl config.
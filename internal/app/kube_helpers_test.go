@@ -0,0 +1,70 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_metadataChanges(t *testing.T) {
+	current := map[string]string{
+		"kubernetes.io/metadata.name": "staging",
+		"MANAGED-BY":                  "HELMSMAN",
+		"team":                        "a",
+		"env":                         "dev",
+		"manual":                      "yes",
+	}
+	tests := []struct {
+		name          string
+		desired       map[string]string
+		authoritative bool
+		want          []string
+	}{
+		{name: "up to date", desired: map[string]string{"team": "a"}},
+		{name: "changed and added", desired: map[string]string{"team": "b", "env": "dev", "tier": "web"}, want: []string{"team=b", "tier=web"}},
+		{name: "authoritative", desired: map[string]string{"team": "a"}, authoritative: true, want: []string{"env-", "manual-"}},
+		{name: "nothing desired", desired: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metadataChanges(tt.desired, current, tt.authoritative); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("metadataChanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_namespaceManifest(t *testing.T) {
+	want := namespaceObject{"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]interface{}{
+		"name":   "staging",
+		"labels": map[string]string{"team": "a"},
+	}}
+	if got := namespaceManifest("staging", map[string]string{"team": "a"}, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaceManifest() = %v, want %v", got, want)
+	}
+}
+
+func Test_resourceQuotaObjects(t *testing.T) {
+	curContext = "test-ctx"
+	if objects := resourceQuotaObjects("staging", nil); len(objects) != 0 {
+		t.Errorf("resourceQuotaObjects() without quotas = %v, want none", objects)
+	}
+	quotas := &Quotas{Pods: "10", CPULimits: "4", CustomQuotas: []CustomResource{{Name: "requests.nvidia.com/gpu", Value: "2"}}}
+	objects := resourceQuotaObjects("staging", quotas)
+	if len(objects) != 1 || objects[0].name() != "resource-quota" || objects[0].kind() != "ResourceQuota" {
+		t.Fatalf("resourceQuotaObjects() = %v, want the resource-quota object", objects)
+	}
+	want := map[string]string{"pods": "10", "limits.cpu": "4", "requests.nvidia.com/gpu": "2"}
+	if got := objects[0]["spec"].(map[string]interface{})["hard"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("resourceQuotaObjects() hard = %v, want %v", got, want)
+	}
+}
+
+func Test_limitRangeObjects(t *testing.T) {
+	if objects := limitRangeObjects("staging", nil); len(objects) != 0 {
+		t.Errorf("limitRangeObjects() without limits = %v, want none", objects)
+	}
+	objects := limitRangeObjects("staging", Limits{{Type: "Container", Max: Resources{CPU: "1"}}})
+	if len(objects) != 1 || objects[0].name() != "limit-range" || objects[0].kind() != "LimitRange" {
+		t.Fatalf("limitRangeObjects() = %v, want the limit-range object", objects)
+	}
+}
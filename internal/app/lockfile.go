@@ -0,0 +1,290 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// lockFileName is the name of the file recording the chart every app was resolved to
+const lockFileName = "helmsman.lock"
+
+const lockFileHeader = "# This file is generated by helmsman --lock, do not edit it by hand.\n"
+
+// lockFile records the exact chart every app was resolved to, so that repeated runs of the same desired state deploy the same charts
+type lockFile struct {
+	Apps map[string]*lockedChart `json:"apps"`
+}
+
+// lockedChart is the chart an app was resolved to
+type lockedChart struct {
+	Chart      string `json:"chart"`
+	Constraint string `json:"constraint"`
+	Version    string `json:"version"`
+	Repository string `json:"repository,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// indexedChart is a chart version listed in a helm repository index
+type indexedChart struct {
+	Version string `json:"version"`
+	Digest  string `json:"digest"`
+}
+
+// chartSources finds the repository URL and package digest of charts using the local helm repositories cache
+type chartSources struct {
+	repos   map[string]string
+	cache   string
+	indexes map[string]map[string][]indexedChart
+}
+
+// lockFilePath returns the path of the lock file, which is kept next to the first desired state file.
+// Each cluster of a multi-cluster desired state has its own lock file.
+func lockFilePath(files fileOptionArray, cluster string) string {
+	dir := "."
+	if len(files) > 0 {
+		dir = filepath.Dir(files[0].name)
+	}
+	name := lockFileName
+	if cluster != "" {
+		name = strings.TrimSuffix(lockFileName, ".lock") + "." + cluster + ".lock"
+	}
+	return filepath.Join(dir, name)
+}
+
+// readLockFile reads a lock file, a missing lock file is the same as an empty one
+func readLockFile(path string) (*lockFile, error) {
+	lock := &lockFile{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, lock); err != nil {
+			return nil, fmt.Errorf("invalid lock file %s: %w", path, err)
+		}
+	}
+	if lock.Apps == nil {
+		lock.Apps = make(map[string]*lockedChart)
+	}
+	return lock, nil
+}
+
+// write writes the lock file
+func (l *lockFile) write(path string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(lockFileHeader), data...), 0o644)
+}
+
+// readLock reads the lock file and pins the apps to the chart versions it records.
+// Nothing is pinned when refreshing the lock file with --lock.
+func (s *State) readLock() (*lockFile, error) {
+	path := lockFilePath(flags.files, flags.cluster)
+	lock, err := readLockFile(path)
+	if err != nil || flags.lock {
+		return lock, err
+	}
+	outdated, err := s.pinLockedVersions(lock, flags.frozenLockfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range outdated {
+		log.Warning("The chart or version of app [ " + app + " ] changed since it was locked in " + path + ", run with --lock to update it.")
+	}
+	return lock, nil
+}
+
+// updateLock records the resolved charts in the lock file with --lock, or checks them against it with --frozen-lockfile
+func (s *State) updateLock(lock *lockFile) error {
+	resolved := s.resolvedCharts(newChartSources())
+	if flags.frozenLockfile {
+		return lock.verify(resolved)
+	}
+	path := lockFilePath(flags.files, flags.cluster)
+	lock.update(resolved, s)
+	if err := lock.write(path); err != nil {
+		return fmt.Errorf("failed to write the lock file: %w", err)
+	}
+	log.Info("Chart versions locked in " + path)
+	return nil
+}
+
+// pinLockedVersions replaces the version constraints of the apps with the exact versions they are locked to.
+// Apps whose chart or version constraint changed since they were locked are resolved again and returned,
+// unless the lock is frozen in which case any app that can't be pinned is an error.
+func (s *State) pinLockedVersions(lock *lockFile, frozen bool) ([]string, error) {
+	var (
+		outdated []string
+		errs     []string
+	)
+	s.versionConstraints = make(map[string]string)
+	for _, app := range s.lockableApps() {
+		r := s.Apps[app]
+		s.versionConstraints[app] = r.Version
+		locked, ok := lock.Apps[app]
+		switch {
+		case ok && locked.Chart == r.Chart && locked.Constraint == r.Version:
+			r.Version = locked.Version
+		case frozen && !ok:
+			errs = append(errs, fmt.Sprintf("app [ %s ] is not locked", app))
+		case frozen:
+			errs = append(errs, fmt.Sprintf("app [ %s ] is locked to chart [ %s ] version [ %s ] but uses chart [ %s ] version [ %s ]",
+				app, locked.Chart, locked.Constraint, r.Chart, r.Version))
+		case ok:
+			outdated = append(outdated, app)
+		}
+	}
+	sort.Strings(outdated)
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return outdated, fmt.Errorf("the lock file is out of date, run with --lock to update it:\n%s", strings.Join(errs, "\n"))
+	}
+	return outdated, nil
+}
+
+// lockableApps returns the apps that are considered to run with charts from repositories, local charts are never locked
+func (s *State) lockableApps() []string {
+	var apps []string
+	for app, r := range s.Apps {
+		if r.isConsideredToRun() && !isLocalChart(r.Chart) {
+			apps = append(apps, app)
+		}
+	}
+	sort.Strings(apps)
+	return apps
+}
+
+// resolvedCharts returns the charts the apps were resolved to, it needs the charts info to be retrieved first
+func (s *State) resolvedCharts(sources *chartSources) map[string]*lockedChart {
+	resolved := make(map[string]*lockedChart)
+	for _, app := range s.lockableApps() {
+		r := s.Apps[app]
+		info := s.chartInfo[r.Chart][r.Version]
+		if info == nil {
+			continue
+		}
+		constraint, ok := s.versionConstraints[app]
+		if !ok {
+			constraint = r.Version
+		}
+		repository, digest := sources.lookup(r.Chart, info.Version)
+		resolved[app] = &lockedChart{
+			Chart:      r.Chart,
+			Constraint: constraint,
+			Version:    info.Version,
+			Repository: repository,
+			Digest:     digest,
+		}
+	}
+	return resolved
+}
+
+// verify checks that the charts the apps were resolved to are the ones they are locked to
+func (l *lockFile) verify(resolved map[string]*lockedChart) error {
+	var errs []string
+	for app, c := range resolved {
+		locked, ok := l.Apps[app]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("app [ %s ] is not locked", app))
+		case locked.Version != c.Version:
+			errs = append(errs, fmt.Sprintf("app [ %s ] is locked to version [ %s ] of chart [ %s ] but resolved to version [ %s ]", app, locked.Version, c.Chart, c.Version))
+		case locked.Repository != "" && c.Repository != "" && locked.Repository != c.Repository:
+			errs = append(errs, fmt.Sprintf("app [ %s ] is locked to repository [ %s ] but resolved to repository [ %s ]", app, locked.Repository, c.Repository))
+		case locked.Digest != "" && c.Digest != "" && locked.Digest != c.Digest:
+			errs = append(errs, fmt.Sprintf("app [ %s ] is locked to a package of chart [ %s ] version [ %s ] with digest [ %s ] but the repository has digest [ %s ]", app, c.Chart, c.Version, locked.Digest, c.Digest))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("charts don't match the lock file:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// update records the resolved charts and forgets the apps that are no longer in the desired state
+func (l *lockFile) update(resolved map[string]*lockedChart, s *State) {
+	for app := range l.Apps {
+		if _, ok := s.Apps[app]; !ok {
+			delete(l.Apps, app)
+		}
+	}
+	for app, c := range resolved {
+		l.Apps[app] = c
+	}
+}
+
+// newChartSources reads the configured helm repositories and the location of their cached indexes
+func newChartSources() *chartSources {
+	cs := &chartSources{repos: make(map[string]string), indexes: make(map[string]map[string][]indexedChart)}
+
+	cmd := helmCmd([]string{"repo", "list", "--output", "json"}, "Listing helm repositories")
+	if res, err := cmd.Exec(); err == nil {
+		var repos []helmRepo
+		if err := json.Unmarshal([]byte(res.output), &repos); err == nil {
+			for _, repo := range repos {
+				cs.repos[repo.Name] = withoutCredentials(repo.URL)
+			}
+		}
+	}
+
+	cmd = helmCmd([]string{"env", "HELM_REPOSITORY_CACHE"}, "Finding the helm repositories cache")
+	if res, err := cmd.Exec(); err == nil {
+		cs.cache = strings.TrimSpace(res.output)
+	}
+	return cs
+}
+
+// lookup returns the repository URL of a chart and the digest of the package of the given version, when they can be found
+func (cs *chartSources) lookup(chart, version string) (string, string) {
+	if strings.HasPrefix(chart, "oci://") {
+		return strings.TrimSuffix(chart, "/"+filepath.Base(chart)), ""
+	}
+	parts := strings.SplitN(chart, "/", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	repo, name := parts[0], parts[1]
+	for _, c := range cs.index(repo)[name] {
+		if c.Version == version {
+			return cs.repos[repo], c.Digest
+		}
+	}
+	return cs.repos[repo], ""
+}
+
+// index returns the charts listed in the cached index of a helm repository
+func (cs *chartSources) index(repo string) map[string][]indexedChart {
+	if index, ok := cs.indexes[repo]; ok {
+		return index
+	}
+	var index struct {
+		Entries map[string][]indexedChart `json:"entries"`
+	}
+	if cs.cache != "" {
+		if data, err := os.ReadFile(filepath.Join(cs.cache, repo+"-index.yaml")); err == nil {
+			_ = yaml.Unmarshal(data, &index)
+		}
+	}
+	cs.indexes[repo] = index.Entries
+	return index.Entries
+}
+
+// withoutCredentials removes the user info from a repository URL
+func withoutCredentials(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.User == nil {
+		return repoURL
+	}
+	u.User = nil
+	return u.String()
+}
@@ -1,8 +1,8 @@
 package app
 
 import (
+	"io"
 	"net/url"
-	"os"
 
 	"github.com/apsdehal/go-logger"
 )
@@ -32,6 +32,8 @@ func (l *Logger) Error(message string) {
 
 func (l *Logger) Fatal(message string) {
 	l.notifyAboutFailureUsingWebhooks(message)
+	// deferred calls don't run on exit, so the decrypted secrets and the temp files are removed here
+	removeTempFiles()
 	l.Logger.Fatal(message)
 }
 
@@ -44,7 +46,7 @@ func (l *Logger) notifyAboutFailureUsingWebhooks(message string) {
 	}
 }
 
-func initLogs(verbose bool, noColors bool) {
+func initLogs(verbose bool, noColors bool, out io.Writer) {
 	logger.SetDefaultFormat("%{time:2006-01-02 15:04:05} %{level}: %{message}")
 	logLevel := logger.InfoLevel
 	if verbose {
@@ -54,5 +56,6 @@ func initLogs(verbose bool, noColors bool) {
 	if noColors {
 		colors = 0
 	}
-	log.Logger, _ = logger.New("logger", colors, os.Stdout, logLevel)
+	// secret values are redacted from everything that is logged
+	log.Logger, _ = logger.New("logger", colors, redactingWriter{out: out}, logLevel)
 }
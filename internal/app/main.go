@@ -9,7 +9,6 @@ const (
 	helmBin            = "helm"
 	kubectlBin         = "kubectl"
 	appVersion         = "v3.18.0"
-	tempFilesDir       = ".helmsman-tmp"
 	defaultContextName = "default"
 	resourcePool       = 10
 )
@@ -20,10 +19,12 @@ const (
 )
 
 var (
-	flags      cli
-	settings   *Config
-	curContext string
-	log        = &Logger{}
+	// tempFilesDir is suffixed with the cluster name when running against one of multiple clusters
+	tempFilesDir = ".helmsman-tmp"
+	flags        cli
+	settings     *Config
+	curContext   string
+	log          = &Logger{}
 )
 
 func init() {
@@ -37,8 +38,21 @@ func Main() int {
 
 	flags.parse()
 
-	// delete temp files with substituted env vars when the program terminates
-	defer os.RemoveAll(tempFilesDir)
+	if flags.command == importCommand {
+		context := flags.contextOverride
+		if context == "" {
+			context = defaultContextName
+		}
+		if err := importReleases(flags.importNamespaces, flags.importOutput, context, flags.importLabel); err != nil {
+			log.Fatal("failed to import helm releases: " + err.Error())
+		}
+		return exitCodeSucceed
+	}
+
+	// delete temp files with substituted env vars and decrypted secrets when the program terminates,
+	// a panic runs the deferred calls too, goroutines clean up with cleanupOnPanic and Logger.Fatal removes them before exiting
+	removeOnSignal()
+	defer removeTempFiles()
 	if !flags.noCleanup {
 		defer s.cleanup()
 	}
@@ -47,6 +61,33 @@ func Main() int {
 		log.Fatal(err.Error())
 	}
 
+	if flags.exportState != "" {
+		if err := s.export(flags.exportState, flags.exportStateSources); err != nil {
+			log.Fatal("failed to export the desired state: " + err.Error())
+		}
+		return exitCodeSucceed
+	}
+
+	if flags.command == outdatedCommand {
+		if err := addHelmRepos(s.HelmRepos); err != nil {
+			log.Fatal(err.Error())
+		}
+		updates := s.outdated()
+		if err := printOutdated(updates, flags.outdatedFormat, os.Stdout); err != nil {
+			log.Fatal(err.Error())
+		}
+		if flags.updateCharts != "" {
+			if err := s.updateCharts(updates, flags.updateCharts); err != nil {
+				log.Fatal("failed to update the chart versions: " + err.Error())
+			}
+		}
+		return exitCodeSucceed
+	}
+
+	if len(s.Clusters) > 0 && flags.cluster == "" {
+		return runClusters(&s)
+	}
+
 	if len(flags.target) > 0 && len(s.targetMap) == 0 {
 		log.Info("No apps defined with -target flag were found, exiting")
 		os.Exit(0)
@@ -57,6 +98,11 @@ func Main() int {
 		os.Exit(0)
 	}
 
+	if len(flags.selector) > 0 && len(s.targetMap) == 0 {
+		log.Info("No apps matching the -selector flag were found, exiting")
+		os.Exit(0)
+	}
+
 	log.SlackWebhook = s.Settings.SlackWebhook
 	log.MSTeamsWebhook = s.Settings.MSTeamsWebhook
 
@@ -77,16 +123,15 @@ func Main() int {
 		log.Fatal(err.Error())
 	}
 
-	if flags.apply || flags.dryRun || flags.destroy {
-		// add/validate namespaces
-		if !flags.noNs {
-			log.Info("Setting up namespaces")
-			if flags.nsOverride == "" {
-				addNamespaces(&s)
-			} else {
-				createNamespace(flags.nsOverride, nil, nil)
-				s.overrideAppsNamespace(flags.nsOverride)
-			}
+	if !flags.noNs && flags.nsOverride != "" {
+		s.overrideAppsNamespace(flags.nsOverride)
+	}
+
+	var lock *lockFile
+	if !flags.destroy {
+		var err error
+		if lock, err = s.readLock(); err != nil {
+			log.Fatal(err.Error())
 		}
 	}
 
@@ -101,6 +146,12 @@ func Main() int {
 		log.Info("Charts validated.")
 	}
 
+	if lock != nil && (flags.lock || flags.frozenLockfile) {
+		if err := s.updateLock(lock); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
 	if flags.destroy {
 		log.Warning("Destroy flag is enabled. Your releases will be deleted!")
 	}
@@ -119,9 +170,15 @@ func Main() int {
 	log.Info("Preparing plan")
 	cs := s.getCurrentState()
 	p := cs.makePlan(&s)
+	if !flags.noNs && !flags.destroy {
+		s.planNamespaces(p)
+	}
 	if !flags.keepUntrackedReleases {
 		cs.cleanUntrackedReleases(&s, p)
 	}
+	if flags.checkPodSecurity && !flags.destroy {
+		s.checkPodSecurity()
+	}
 
 	p.sort()
 	p.print()
@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Resources type
@@ -54,10 +55,30 @@ type Quotas struct {
 	CustomQuotas []CustomResource `json:"customQuotas,omitempty"`
 }
 
+// hard returns the hard limits of the ResourceQuota, keyed by resource
+func (q *Quotas) hard() map[string]string {
+	hard := make(map[string]string)
+	for k, v := range map[string]string{
+		"pods":            q.Pods,
+		"limits.cpu":      q.CPULimits,
+		"requests.cpu":    q.CPURequests,
+		"limits.memory":   q.MemoryLimits,
+		"requests.memory": q.MemoryRequests,
+	} {
+		if v != "" {
+			hard[k] = v
+		}
+	}
+	for _, c := range q.CustomQuotas {
+		hard[c.Name] = c.Value
+	}
+	return hard
+}
+
 // Namespace type represents the fields of a Namespace
 type Namespace struct {
 	// Protected if set to true no changes can be applied to the namespace
-	Protected bool `json:"protected"`
+	Protected NullBool `json:"protected"`
 	// Limits to set on the namespace
 	Limits Limits `json:"limits,omitempty"`
 	// Labels to set to the namespace
@@ -65,7 +86,21 @@ type Namespace struct {
 	// Annotations to set on the namespace
 	Annotations map[string]string `json:"annotations,omitempty"`
 	// Quotas to set on the namespace
-	Quotas   *Quotas `json:"quotas,omitempty"`
+	Quotas *Quotas `json:"quotas,omitempty"`
+	// NetworkPolicies to manage in the namespace
+	NetworkPolicies *NetworkPolicies `json:"networkPolicies,omitempty"`
+	// RBAC roles and role bindings to manage in the namespace
+	RBAC *RBAC `json:"rbac,omitempty"`
+	// Defaults are the settings inherited by the apps of the namespace when they don't set them
+	Defaults *NamespaceDefaults `json:"defaults,omitempty"`
+	// PodSecurity are the Pod Security Admission levels of the namespace, set as labels
+	PodSecurity *PodSecurity `json:"podSecurity,omitempty"`
+	// ImagePullSecrets are docker-registry secrets to manage in the namespace, keyed by name
+	ImagePullSecrets map[string]*ImagePullSecret `json:"imagePullSecrets,omitempty"`
+	// Manifests are files, URLs or globs of files with k8s objects to apply in the namespace
+	Manifests []string `json:"manifests,omitempty"`
+	// Template is the name, or list of names, of the namespaceTemplates the namespace inherits from
+	Template StringList `json:"template,omitempty"`
 	disabled bool
 }
 
@@ -73,13 +108,85 @@ func (n *Namespace) Disable() {
 	n.disabled = true
 }
 
+// validate validates the namespace definition
+func (n *Namespace) validate() error {
+	if err := n.NetworkPolicies.validate(); err != nil {
+		return fmt.Errorf("networkPolicies: %w", err)
+	}
+	if err := n.RBAC.validate(); err != nil {
+		return fmt.Errorf("rbac: %w", err)
+	}
+	if err := n.Defaults.validate(); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	if err := n.PodSecurity.validate(); err != nil {
+		return fmt.Errorf("podSecurity: %w", err)
+	}
+	for name, ips := range n.ImagePullSecrets {
+		if !dns1123Name.MatchString(name) {
+			return fmt.Errorf("imagePullSecrets: secret name [ %s ] is not a valid k8s object name", name)
+		}
+		if err := ips.validate(); err != nil {
+			return fmt.Errorf("imagePullSecrets: secret [ %s ]: %w", name, err)
+		}
+	}
+	for _, m := range n.Manifests {
+		if strings.TrimSpace(m) == "" {
+			return fmt.Errorf("manifests: manifest paths can't be empty")
+		}
+	}
+	for label := range n.Labels {
+		if n.PodSecurity != nil && strings.HasPrefix(label, podSecurityLabelPrefix) {
+			return fmt.Errorf("label [ %s ] is set by podSecurity, it can't be defined in labels too", label)
+		}
+	}
+	return nil
+}
+
 // print prints the namespace
 func (n *Namespace) print() {
-	fmt.Println("\tprotected: ", n.Protected)
+	fmt.Println("\tprotected: ", n.Protected.Value)
 	fmt.Println("\tdisabled: ", n.disabled)
+	if len(n.Template) > 0 {
+		fmt.Println("\ttemplate: ", strings.Join(n.Template, ", "))
+	}
 	fmt.Println("\tlabels:")
 	printMap(n.Labels, 2)
 	fmt.Println("\tannotations:")
 	printMap(n.Annotations, 2)
+	if n.NetworkPolicies != nil {
+		fmt.Println("\tnetworkPolicies:")
+		fmt.Println("\t\tpresets: ", strings.Join(n.NetworkPolicies.Presets, ", "))
+		fmt.Println("\t\tcustom: ", strings.Join(sortedKeys(n.NetworkPolicies.Custom), ", "))
+	}
+	if n.RBAC != nil {
+		fmt.Println("\trbac:")
+		fmt.Println("\t\troles: ", strings.Join(sortedKeys(n.RBAC.Roles), ", "))
+		fmt.Println("\t\tbindings: ", strings.Join(sortedKeys(n.RBAC.Bindings), ", "))
+	}
+	if len(n.ImagePullSecrets) > 0 {
+		fmt.Println("\timagePullSecrets: ", strings.Join(sortedKeys(n.ImagePullSecrets), ", "))
+	}
+	if len(n.Manifests) > 0 {
+		fmt.Println("\tmanifests: ", strings.Join(n.Manifests, ", "))
+	}
+	if ps := n.PodSecurity; ps != nil {
+		fmt.Println("\tpodSecurity:")
+		fmt.Println("\t\tenforce: ", ps.Enforce)
+		fmt.Println("\t\taudit: ", ps.Audit)
+		fmt.Println("\t\twarn: ", ps.Warn)
+		fmt.Println("\t\tversion: ", ps.Version)
+	}
+	if d := n.Defaults; d != nil {
+		fmt.Println("\tdefaults:")
+		fmt.Println("\t\twait: ", d.Wait.Value)
+		fmt.Println("\t\ttimeout: ", d.Timeout)
+		fmt.Println("\t\thelmFlags: ", strings.Join(d.HelmFlags, " "))
+		fmt.Println("\t\tmaxHistory: ", d.MaxHistory)
+		fmt.Println("\t\tprotected: ", d.Protected.Value)
+		fmt.Println("\t\tvaluesFiles: ", strings.Join(d.ValuesFiles, ","))
+		fmt.Println("\t\tpostRenderer: ", d.PostRenderer)
+		fmt.Println("\t\thooks: ", strings.Join(sortedKeys(d.Hooks), ", "))
+	}
 	fmt.Println("-------------------")
 }
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NamespaceDefaults type represents the settings inherited by the apps of a namespace when they don't set them.
+// Apps settings take priority over the namespace defaults, which take priority over the global settings.
+type NamespaceDefaults struct {
+	// Wait defines whether helm should block execution until all k8s resources are in a ready state
+	Wait NullBool `json:"wait,omitempty"`
+	// Timeout is the number of seconds to wait for the releases to complete
+	Timeout int `json:"timeout,omitempty"`
+	// HelmFlags is a list of additional flags to pass to the helm command
+	HelmFlags []string `json:"helmFlags,omitempty"`
+	// Hooks are lifecycle hooks, each hook type is inherited when the app doesn't define it
+	Hooks map[string]interface{} `json:"hooks,omitempty"`
+	// MaxHistory is the maximum number of historical releases to keep
+	MaxHistory int `json:"maxHistory,omitempty"`
+	// Protected defines if the releases should be protected against changes
+	Protected NullBool `json:"protected,omitempty"`
+	// ValuesFiles is a list of paths of values files, used by the apps that don't define any values file
+	ValuesFiles []string `json:"valuesFiles,omitempty"`
+	// PostRenderer is the path to an executable to be used for post rendering
+	PostRenderer string `json:"postRenderer,omitempty"`
+}
+
+// validate validates the namespace defaults
+func (d *NamespaceDefaults) validate() error {
+	if d == nil {
+		return nil
+	}
+	if d.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	}
+	if d.MaxHistory < 0 {
+		return errors.New("maxHistory can't be negative")
+	}
+	for _, f := range d.ValuesFiles {
+		if err := isValidFile(f, validManifestFiles); err != nil {
+			return fmt.Errorf("invalid values file: %w", err)
+		}
+	}
+	if len(d.Hooks) != 0 {
+		if err := validateHooks(d.Hooks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolvePaths resolves the paths of the values files and hooks files relative to the desired state file, like the apps ones,
+// and substitutes the env variables in them
+func (d *NamespaceDefaults) resolvePaths(dir, downloadDest string) {
+	// the values files and hooks are updated in place
+	r := Release{ValuesFiles: d.ValuesFiles, Hooks: d.Hooks}
+	r.resolvePaths(dir, downloadDest)
+	r.substituteVarsInStaticFiles()
+}
+
+// inheritNamespaceDefaults passes the defaults of the release namespace to the release if they are unset
+func (r *Release) inheritNamespaceDefaults(s *State) {
+	ns, ok := s.Namespaces[r.Namespace]
+	if !ok || ns == nil || ns.Defaults == nil {
+		return
+	}
+	d := ns.Defaults
+	if !r.Wait.HasValue {
+		r.Wait = d.Wait
+	}
+	if r.Timeout == 0 {
+		r.Timeout = d.Timeout
+	}
+	if len(r.HelmFlags) == 0 && len(d.HelmFlags) > 0 {
+		r.HelmFlags = append([]string(nil), d.HelmFlags...)
+	}
+	if len(d.Hooks) != 0 {
+		hooks := make(map[string]interface{}, len(d.Hooks)+len(r.Hooks))
+		for k, v := range d.Hooks {
+			hooks[k] = v
+		}
+		for k, v := range r.Hooks {
+			hooks[k] = v
+		}
+		r.Hooks = hooks
+	}
+	if r.MaxHistory == 0 {
+		r.MaxHistory = d.MaxHistory
+	}
+	if !r.Protected.HasValue {
+		r.Protected = d.Protected
+	}
+	if r.ValuesFile == "" && len(r.ValuesFiles) == 0 && len(d.ValuesFiles) > 0 {
+		r.ValuesFiles = append([]string(nil), d.ValuesFiles...)
+	}
+	if r.PostRenderer == "" {
+		r.PostRenderer = d.PostRenderer
+	}
+}
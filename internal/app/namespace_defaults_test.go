@@ -0,0 +1,114 @@
+package app
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_Release_inheritNamespaceDefaults(t *testing.T) {
+	s := &State{
+		Settings: Config{
+			GlobalMaxHistory: 10,
+			GlobalHooks:      map[string]interface{}{"successTimeout": "60s", preInstall: "global.yaml"},
+		},
+		Namespaces: map[string]*Namespace{
+			"staging": {Defaults: &NamespaceDefaults{
+				Wait:         NullBool{HasValue: true, Value: true},
+				Timeout:      600,
+				HelmFlags:    []string{"--atomic"},
+				Hooks:        map[string]interface{}{preInstall: "staging.yaml", postInstall: "staging-post.yaml"},
+				MaxHistory:   5,
+				Protected:    NullBool{HasValue: true, Value: true},
+				ValuesFiles:  []string{"staging.yaml"},
+				PostRenderer: "kustomize.sh",
+			}},
+			"production": {},
+		},
+		Apps: map[string]*Release{
+			"inherits": {Namespace: "staging"},
+			"overrides": {
+				Namespace:  "staging",
+				Wait:       NullBool{HasValue: true, Value: false},
+				Timeout:    60,
+				HelmFlags:  []string{"--force"},
+				Hooks:      map[string]interface{}{postInstall: "app-post.yaml"},
+				MaxHistory: 3,
+				Protected:  NullBool{HasValue: true, Value: false},
+				ValuesFile: "app.yaml",
+			},
+			"global": {Namespace: "production"},
+		},
+	}
+	s.setDefaults()
+
+	r := s.Apps["inherits"]
+	if !r.Wait.Value || r.Timeout != 600 || !reflect.DeepEqual(r.HelmFlags, []string{"--atomic"}) || r.MaxHistory != 5 ||
+		!r.Protected.Value || !reflect.DeepEqual(r.ValuesFiles, []string{"staging.yaml"}) || r.PostRenderer != "kustomize.sh" {
+		t.Errorf("inheritNamespaceDefaults() = %+v, want the namespace defaults", r)
+	}
+	wantHooks := map[string]interface{}{preInstall: "staging.yaml", postInstall: "staging-post.yaml", "successTimeout": "60s"}
+	if !reflect.DeepEqual(r.Hooks, wantHooks) {
+		t.Errorf("inheritNamespaceDefaults() hooks = %v, want %v", r.Hooks, wantHooks)
+	}
+
+	r = s.Apps["overrides"]
+	if r.Wait.Value || r.Timeout != 60 || !reflect.DeepEqual(r.HelmFlags, []string{"--force"}) || r.MaxHistory != 3 ||
+		r.Protected.Value || len(r.ValuesFiles) != 0 || r.PostRenderer != "kustomize.sh" {
+		t.Errorf("inheritNamespaceDefaults() = %+v, want the app settings to take priority", r)
+	}
+	wantHooks = map[string]interface{}{preInstall: "staging.yaml", postInstall: "app-post.yaml", "successTimeout": "60s"}
+	if !reflect.DeepEqual(r.Hooks, wantHooks) {
+		t.Errorf("inheritNamespaceDefaults() hooks = %v, want %v", r.Hooks, wantHooks)
+	}
+
+	r = s.Apps["global"]
+	if r.MaxHistory != 10 || r.Hooks[preInstall] != "global.yaml" || r.Wait.HasValue {
+		t.Errorf("inheritNamespaceDefaults() = %+v, want the global settings", r)
+	}
+	if len(s.Namespaces["staging"].Defaults.Hooks) != 2 {
+		t.Errorf("inheritNamespaceDefaults() changed the namespace defaults hooks: %v", s.Namespaces["staging"].Defaults.Hooks)
+	}
+}
+
+func Test_NamespaceDefaults_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *NamespaceDefaults
+		wantErr bool
+	}{
+		{name: "nil", d: nil},
+		{name: "valid", d: &NamespaceDefaults{Timeout: 300, MaxHistory: 5, ValuesFiles: []string{"../../examples/example.yaml"}}},
+		{name: "negative timeout", d: &NamespaceDefaults{Timeout: -1}, wantErr: true},
+		{name: "negative maxHistory", d: &NamespaceDefaults{MaxHistory: -1}, wantErr: true},
+		{name: "missing values file", d: &NamespaceDefaults{ValuesFiles: []string{"missing.yaml"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.d.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_NamespaceDefaults_resolvePaths(t *testing.T) {
+	if err := os.MkdirAll(tempFilesDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempFilesDir)
+	d := &NamespaceDefaults{ValuesFiles: []string{"example.yaml"}}
+	d.resolvePaths("../../examples", t.TempDir())
+	if len(d.ValuesFiles) != 1 {
+		t.Fatalf("resolvePaths() = %v, want one values file", d.ValuesFiles)
+	}
+	// the values files are copied with their env variables substituted, like the apps ones
+	got, err := os.ReadFile(d.ValuesFiles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile("../../examples/example.yaml")
+	if string(got) != string(want) {
+		t.Errorf("resolvePaths() resolved %s, want a copy of examples/example.yaml", d.ValuesFiles[0])
+	}
+}
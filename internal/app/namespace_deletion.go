@@ -0,0 +1,151 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// helmsmanProtectedLabel marks the namespaces that are protected in the DSF, so they are never deleted once removed from it
+const helmsmanProtectedLabel = "HELMSMAN_PROTECTED"
+
+// systemNamespaces are never deleted, even when Helmsman created them
+var systemNamespaces = []string{"default", "kube-system", "kube-public", "kube-node-lease"}
+
+// namespaceLabels returns the labels of a namespace: the ones defined in the DSF, the Pod Security Admission ones
+// and, with settings.namespacesAuthoritative, the label recording whether it is protected
+func (s *State) namespaceLabels(n *Namespace) map[string]string {
+	if !s.Settings.NamespacesAuthoritative && n.PodSecurity == nil {
+		return n.Labels
+	}
+	labels := copyStringMap(n.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for k, v := range n.PodSecurity.labels() {
+		labels[k] = v
+	}
+	if s.Settings.NamespacesAuthoritative {
+		labels[helmsmanProtectedLabel] = strconv.FormatBool(n.Protected.Value)
+	}
+	return labels
+}
+
+// createdNamespaceLabels returns the labels of a namespace Helmsman creates, which is marked as owned by Helmsman
+func createdNamespaceLabels(labels map[string]string) map[string]string {
+	created := helmsmanOwnedLabels()
+	for k, v := range labels {
+		created[k] = v
+	}
+	return created
+}
+
+// isHelmsmanNamespaceLabel checks if a namespace label is set by Helmsman, and must not be removed by namespaceLabelsAuthoritative
+func isHelmsmanNamespaceLabel(label string) bool {
+	key, _, _ := strings.Cut(helmsmanOwnedLabel, "=")
+	return label == key || label == "HELMSMAN_CONTEXT" || label == helmsmanProtectedLabel
+}
+
+// namespaceDeletionPriority returns the priority of the namespace deletions in the plan, higher than the one of any release,
+// so namespaces are deleted after the releases, including when the delete order is reversed
+func (s *State) namespaceDeletionPriority() int {
+	priority := 1
+	for _, r := range s.Apps {
+		p := r.Priority
+		if p < 0 {
+			p = -p
+		}
+		if p >= priority {
+			priority = p + 1
+		}
+	}
+	return priority
+}
+
+// isDeletionAllowed checks if a namespace matches the patterns of settings.namespacesDeletionAllowList
+func (c *Config) isDeletionAllowed(ns string) bool {
+	for _, pattern := range c.NamespacesDeletionAllowList {
+		if matchesTarget(ns, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// deletionSkipReason returns why a namespace removed from the DSF must not be deleted, or an empty string when it can be.
+// Deletion can't be undone, so a namespace without the HELMSMAN_PROTECTED label, e.g. labeled before
+// settings.namespacesAuthoritative was enabled, is kept since it may have been protected.
+func (c *Config) deletionSkipReason(ns string, labels map[string]interface{}) string {
+	protected, ok := labels[helmsmanProtectedLabel]
+	switch {
+	case !ok:
+		return "has no " + helmsmanProtectedLabel + " label, so it may be protected"
+	case protected != "false":
+		return "is PROTECTED"
+	case !c.isDeletionAllowed(ns):
+		return "is not in settings.namespacesDeletionAllowList"
+	}
+	return ""
+}
+
+// planNamespaceDeletions adds to the plan the deletion of the namespaces Helmsman created that are no longer defined in the DSF.
+// Their releases are uninstalled first. Protected namespaces, namespaces not labeled as unprotected, system namespaces
+// and the ones that don't match settings.namespacesDeletionAllowList are never deleted.
+func (s *State) planNamespaceDeletions(p *plan) {
+	if len(s.targetMap) > 0 {
+		log.Info("Namespaces are not deleted when only some apps are targeted")
+		return
+	}
+	cmd := kubectl([]string{"get", "namespaces", "-l", helmsmanOwnedLabel + ",HELMSMAN_CONTEXT=" + curContext, "-o", "json"},
+		"Getting the namespaces created by Helmsman")
+	res, err := cmd.Exec()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var list struct {
+		Items []namespaceObject `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(res.output), &list); err != nil {
+		log.Fatal(fmt.Sprintf("failed to unmarshal kubectl get namespaces output: %s", err))
+	}
+
+	priority := s.namespaceDeletionPriority()
+	for _, obj := range list.Items {
+		ns := obj.name()
+		if _, ok := s.Namespaces[ns]; ok || stringInSlice(ns, systemNamespaces) {
+			continue
+		}
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		labels, _ := metadata["labels"].(map[string]interface{})
+		if reason := s.Settings.deletionSkipReason(ns, labels); reason != "" {
+			p.addDecision("Namespace [ "+ns+" ] is no longer desired but "+reason+". It will not be deleted.", priority, noop)
+			continue
+		}
+		if err := planNamespaceDeletion(p, ns, priority); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+}
+
+// planNamespaceDeletion adds to the plan the uninstallation of the releases of a namespace, followed by its deletion
+func planNamespaceDeletion(p *plan, ns string, priority int) error {
+	cmd := helmCmd([]string{"list", "--all", "--max", "0", "--output", "json", "-n", ns}, "Listing all existing releases in [ "+ns+" ] namespace")
+	res, err := cmd.RetryExec(3)
+	if err != nil {
+		return err
+	}
+	var releases []helmRelease
+	if err := json.Unmarshal([]byte(res.output), &releases); err != nil {
+		return fmt.Errorf("failed to unmarshal Helm CLI output: %w", err)
+	}
+	for _, r := range releases {
+		p.addDecision("Release [ "+r.Name+" ] in namespace [ "+ns+" ] will be DELETED before its namespace", priority, remove)
+		p.addCommand(helmCmd(concat([]string{"uninstall", r.Name, "--namespace", ns}, flags.getRunFlags()),
+			"Delete release [ "+r.Name+" ] in namespace [ "+ns+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
+	}
+	p.addDecision("Namespace [ "+ns+" ] is no longer desired and will be DELETED", priority+1, remove)
+	p.addCommand(kubectl([]string{"delete", "namespace", ns, "--ignore-not-found", flags.getKubeDryRunFlag("delete")},
+		"Deleting namespace [ "+ns+" ]"), priority+1, nil, []hookCmd{}, []hookCmd{})
+	return nil
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_State_namespaceDeletionPriority(t *testing.T) {
+	tests := []struct {
+		name string
+		apps map[string]*Release
+		want int
+	}{
+		{name: "no apps", apps: map[string]*Release{}, want: 1},
+		{name: "default priority", apps: map[string]*Release{"a": {Priority: 0}}, want: 1},
+		{name: "negative priorities", apps: map[string]*Release{"a": {Priority: -3}, "b": {Priority: -7}}, want: 8},
+		{name: "positive priority", apps: map[string]*Release{"a": {Priority: 5}, "b": {Priority: -2}}, want: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &State{Apps: tt.apps}
+			if got := s.namespaceDeletionPriority(); got != tt.want {
+				t.Errorf("namespaceDeletionPriority() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Config_isDeletionAllowed(t *testing.T) {
+	c := &Config{NamespacesDeletionAllowList: []string{"staging", "feature-*"}}
+	tests := []struct {
+		ns   string
+		want bool
+	}{
+		{ns: "staging", want: true},
+		{ns: "feature-login", want: true},
+		{ns: "production", want: false},
+		{ns: "staging-2", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ns, func(t *testing.T) {
+			if got := c.isDeletionAllowed(tt.ns); got != tt.want {
+				t.Errorf("isDeletionAllowed(%s) = %v, want %v", tt.ns, got, tt.want)
+			}
+		})
+	}
+	if (&Config{}).isDeletionAllowed("staging") {
+		t.Errorf("isDeletionAllowed() with an empty allow-list = true, want false")
+	}
+}
+
+func Test_Config_deletionSkipReason(t *testing.T) {
+	c := &Config{NamespacesDeletionAllowList: []string{"staging", "feature-*"}}
+	tests := []struct {
+		name   string
+		ns     string
+		labels map[string]interface{}
+		want   string
+	}{
+		{name: "unprotected and allowed", ns: "staging", labels: map[string]interface{}{helmsmanProtectedLabel: "false"}, want: ""},
+		{name: "protected", ns: "staging", labels: map[string]interface{}{helmsmanProtectedLabel: "true"}, want: "is PROTECTED"},
+		{name: "unknown protection value", ns: "staging", labels: map[string]interface{}{helmsmanProtectedLabel: "yes"}, want: "is PROTECTED"},
+		{name: "no protection label", ns: "feature-login", labels: map[string]interface{}{"MANAGED-BY": "HELMSMAN"}, want: "has no HELMSMAN_PROTECTED label"},
+		{name: "no labels", ns: "staging", labels: nil, want: "has no HELMSMAN_PROTECTED label"},
+		{name: "not allowed", ns: "production", labels: map[string]interface{}{helmsmanProtectedLabel: "false"}, want: "is not in settings.namespacesDeletionAllowList"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.deletionSkipReason(tt.ns, tt.labels)
+			if (tt.want == "" && got != "") || !strings.Contains(got, tt.want) {
+				t.Errorf("deletionSkipReason(%s) = %q, want %q", tt.ns, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_State_namespaceLabels(t *testing.T) {
+	curContext = "test"
+	ns := &Namespace{Protected: True, Labels: map[string]string{"team": "a"}}
+
+	s := &State{}
+	if got := s.namespaceLabels(ns); !reflect.DeepEqual(got, ns.Labels) {
+		t.Errorf("namespaceLabels() = %v, want %v", got, ns.Labels)
+	}
+
+	s.Settings.NamespacesAuthoritative = true
+	want := map[string]string{"team": "a", helmsmanProtectedLabel: "true"}
+	if got := s.namespaceLabels(ns); !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaceLabels() = %v, want %v", got, want)
+	}
+	if _, ok := ns.Labels[helmsmanProtectedLabel]; ok {
+		t.Errorf("namespaceLabels() changed the labels of the namespace")
+	}
+	want = map[string]string{helmsmanProtectedLabel: "false"}
+	if got := s.namespaceLabels(&Namespace{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaceLabels() = %v, want %v", got, want)
+	}
+
+	want = map[string]string{"MANAGED-BY": "HELMSMAN", "HELMSMAN_CONTEXT": "test", "team": "a"}
+	if got := createdNamespaceLabels(ns.Labels); !reflect.DeepEqual(got, want) {
+		t.Errorf("createdNamespaceLabels() = %v, want %v", got, want)
+	}
+}
+
+func Test_isHelmsmanNamespaceLabel(t *testing.T) {
+	for _, label := range []string{"MANAGED-BY", "HELMSMAN_CONTEXT", helmsmanProtectedLabel} {
+		if !isHelmsmanNamespaceLabel(label) {
+			t.Errorf("isHelmsmanNamespaceLabel(%s) = false, want true", label)
+		}
+	}
+	if isHelmsmanNamespaceLabel("team") {
+		t.Errorf("isHelmsmanNamespaceLabel(team) = true, want false")
+	}
+}
@@ -0,0 +1,375 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// manifestsInventoryName is the ConfigMap listing the objects applied from the manifests of a namespace, to prune the removed ones
+const manifestsInventoryName = "helmsman-manifests"
+
+// resolveManifestPaths resolves the manifests of a namespace relative to the DSF directory: globs of local files are expanded
+// and URLs are downloaded
+func resolveManifestPaths(manifests []string, dir, downloadDest string) []string {
+	var files []string
+	for _, m := range manifests {
+		if u, err := url.Parse(m); err == nil && u.Scheme == "" && isGlobPattern(m) {
+			pattern := m
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(dir, pattern)
+			}
+			matches, err := filepath.Glob(pattern)
+			if err != nil || len(matches) == 0 {
+				log.Fatal("manifests pattern [ " + m + " ] does not match any file")
+			}
+			for _, match := range matches {
+				file, _ := resolveOnePath(match, dir, downloadDest)
+				files = append(files, file)
+			}
+			continue
+		}
+		file, _ := resolveOnePath(m, dir, downloadDest)
+		files = append(files, file)
+	}
+	return files
+}
+
+// manifestObjects reads the objects of the manifests of a namespace, a manifest can hold multiple YAML documents.
+// Env variables and secret references are substituted like in values files, in memory so that the secrets are never written
+// to the temp files.
+func manifestObjects(ns string, files []string) ([]namespaceObject, error) {
+	var objects []namespaceObject
+	defined := make(map[string]string)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest [ %s ]: %w", file, err)
+		}
+		docs, err := decodeObjects([]byte(substituteVars(string(data), file)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest [ %s ]: %w", file, err)
+		}
+		for _, obj := range docs {
+			if err := obj.prepareManifest(ns); err != nil {
+				return nil, fmt.Errorf("manifest [ %s ]: %w", file, err)
+			}
+			ref := obj.manifestRef()
+			if other, ok := defined[ref]; ok {
+				return nil, fmt.Errorf("object [ %s ] is defined in both manifests [ %s ] and [ %s ]", ref, other, file)
+			}
+			defined[ref] = file
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// decodeObjects decodes the k8s objects of YAML documents, empty documents are skipped
+func decodeObjects(data []byte) ([]namespaceObject, error) {
+	var objects []namespaceObject
+	dec := yamlv3.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yamlv3.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			return objects, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		raw, err := yamlv3.Marshal(&doc)
+		if err != nil {
+			return nil, err
+		}
+		var obj namespaceObject
+		if err := yaml.Unmarshal(raw, &obj); err != nil {
+			return nil, err
+		}
+		if len(obj) > 0 {
+			objects = append(objects, obj)
+		}
+	}
+}
+
+// prepareManifest checks an object read from a manifest and labels it as Helmsman-owned.
+// The stringData of secrets is moved to their data, since it is not returned by k8s and would always look drifted.
+func (o namespaceObject) prepareManifest(ns string) error {
+	apiVersion, _ := o["apiVersion"].(string)
+	metadata, _ := o["metadata"].(map[string]interface{})
+	if apiVersion == "" || o.kind() == "" || o.name() == "" {
+		return fmt.Errorf("objects must have an apiVersion, a kind and a metadata.name")
+	}
+	ref := o.manifestRef()
+	if ref == "configmap/"+manifestsInventoryName {
+		return fmt.Errorf("the ConfigMap [ %s ] is reserved for the inventory of the manifests", manifestsInventoryName)
+	}
+	if objNs, ok := metadata["namespace"].(string); ok && objNs != "" && objNs != ns {
+		return fmt.Errorf("object [ %s ] belongs to namespace [ %s ], manifests can only hold objects of namespace [ %s ]", ref, objNs, ns)
+	}
+	labels, _ := metadata["labels"].(map[string]interface{})
+	if labels == nil {
+		labels = make(map[string]interface{})
+	}
+	for k, v := range manifestLabels() {
+		labels[k] = v
+	}
+	metadata["labels"] = labels
+
+	if o.kind() == "Secret" {
+		if stringData, ok := o["stringData"].(map[string]interface{}); ok {
+			data, _ := o["data"].(map[string]interface{})
+			if data == nil {
+				data = make(map[string]interface{})
+			}
+			for k, v := range stringData {
+				data[k] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(v)))
+			}
+			o["data"] = data
+			delete(o, "stringData")
+		}
+	}
+	return nil
+}
+
+// manifestRef returns the reference of an object for kubectl, e.g. configmap/name or deployment.v1.apps/name
+func (o namespaceObject) manifestRef() string {
+	apiVersion, _ := o["apiVersion"].(string)
+	resource := strings.ToLower(o.kind())
+	if group, version, ok := strings.Cut(apiVersion, "/"); ok {
+		resource += "." + version + "." + group
+	}
+	return resource + "/" + o.name()
+}
+
+// manifestLabels returns the labels of the objects applied from the manifests and of their inventory
+func manifestLabels() map[string]string {
+	key, value, _ := strings.Cut(helmsmanManifestLabel, "=")
+	return map[string]string{key: value, "HELMSMAN_CONTEXT": curContext}
+}
+
+// manifestsInventory returns the ConfigMap listing the objects applied from the manifests of a namespace
+func manifestsInventory(ns string, refs []string) namespaceObject {
+	return namespaceObject{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      manifestsInventoryName,
+			"namespace": ns,
+			"labels":    manifestLabels(),
+		},
+		"data": map[string]interface{}{"objects": strings.Join(refs, "\n")},
+	}
+}
+
+// getManifestsInventory returns the objects applied from the manifests of a namespace by a previous run
+func getManifestsInventory(ns string) ([]string, error) {
+	cmd := kubectl([]string{"get", "configmap", manifestsInventoryName, "-n", ns, "--ignore-not-found", "-o", "json"},
+		"Getting the manifests inventory of namespace [ "+ns+" ]")
+	res, err := cmd.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("error getting the manifests inventory of namespace [ %s ]: %w", ns, err)
+	}
+	if strings.TrimSpace(res.output) == "" {
+		return nil, nil
+	}
+	var inventory struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(res.output), &inventory); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the manifests inventory of namespace [ %s ]: %w", ns, err)
+	}
+	return strings.Fields(inventory.Data["objects"]), nil
+}
+
+// getManifestObject returns the current state of an object of the manifests, or nil when it doesn't exist
+func getManifestObject(ns string, obj namespaceObject) (namespaceObject, error) {
+	ref := obj.manifestRef()
+	cmd := kubectl([]string{"get", ref, "-n", ns, "--ignore-not-found", "-o", "json"},
+		"Getting [ "+ref+" ] in namespace [ "+ns+" ]")
+	res, err := cmd.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("error getting [ %s ] in namespace [ %s ]: %w", ref, ns, err)
+	}
+	if strings.TrimSpace(res.output) == "" {
+		return nil, nil
+	}
+	var current namespaceObject
+	if err := json.Unmarshal([]byte(res.output), &current); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal [ %s ] in namespace [ %s ]: %w", ref, ns, err)
+	}
+	return current, nil
+}
+
+// diffManifests compares the objects of the manifests with the existing ones, keyed by reference, and with the inventory.
+// The drift and the pruned objects are keyed by reference too.
+func diffManifests(desired []namespaceObject, existing map[string]namespaceObject, inventory []string) (namespaceObjectChanges, error) {
+	changes := namespaceObjectChanges{drift: make(map[string][]string)}
+	refs := make(map[string]bool)
+	for _, obj := range desired {
+		ref := obj.manifestRef()
+		refs[ref] = true
+		current, ok := existing[ref]
+		if !ok || current == nil {
+			changes.create = append(changes.create, obj)
+			continue
+		}
+		n, err := obj.normalized()
+		if err != nil {
+			return changes, err
+		}
+		if drift := driftFields(map[string]interface{}(n), map[string]interface{}(current), ""); len(drift) > 0 {
+			if obj.kind() == "Secret" {
+				// only show which fields of secrets changed, not their values
+				for i, d := range drift {
+					drift[i], _, _ = strings.Cut(d, ": ")
+				}
+			}
+			changes.update = append(changes.update, obj)
+			changes.drift[ref] = drift
+		}
+	}
+	for _, ref := range inventory {
+		if !refs[ref] {
+			changes.prune = append(changes.prune, ref)
+		}
+	}
+	return changes, nil
+}
+
+// clusterScoped caches the kinds of the cluster-scoped resources served by the cluster, they are listed once per run
+var clusterScoped struct {
+	once  sync.Once
+	kinds map[string]bool
+	err   error
+}
+
+// getClusterScopedKinds returns the kinds of the cluster-scoped resources served by the cluster, as group/Kind
+func getClusterScopedKinds() (map[string]bool, error) {
+	clusterScoped.once.Do(func() {
+		cmd := kubectl([]string{"api-resources", "--namespaced=false", "--no-headers"}, "Listing the cluster-scoped resources")
+		res, err := cmd.Exec()
+		if err != nil {
+			clusterScoped.err = fmt.Errorf("error listing the cluster-scoped resources: %w", err)
+			return
+		}
+		clusterScoped.kinds = parseAPIResources(res.output)
+	})
+	return clusterScoped.kinds, clusterScoped.err
+}
+
+// parseAPIResources parses the output of kubectl api-resources into a set of group/Kind.
+// The short names column may be empty, so the columns are read from the end: APIVERSION, NAMESPACED and KIND.
+func parseAPIResources(output string) map[string]bool {
+	kinds := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		kinds[apiGroup(fields[len(fields)-3])+"/"+fields[len(fields)-1]] = true
+	}
+	return kinds
+}
+
+// apiGroup returns the group of an apiVersion, empty for the core group
+func apiGroup(apiVersion string) string {
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i]
+	}
+	return ""
+}
+
+// checkNamespaced checks that the manifests of a namespace only hold namespaced objects. Cluster-scoped objects are rejected:
+// they would be pruned with the inventory of one namespace while others still define them.
+func checkNamespaced(ns string, objects []namespaceObject, clusterScoped map[string]bool) error {
+	for _, obj := range objects {
+		apiVersion, _ := obj["apiVersion"].(string)
+		if clusterScoped[apiGroup(apiVersion)+"/"+obj.kind()] {
+			return fmt.Errorf("object [ %s ] in the manifests of namespace [ %s ] is cluster-scoped, manifests can only hold namespaced objects",
+				obj.manifestRef(), ns)
+		}
+	}
+	return nil
+}
+
+// planManifests adds to the plan the server-side apply of the objects of the manifests of a namespace that are missing or drifted,
+// the deletion of the objects removed from the manifests since the previous run, and the update of the manifests inventory
+func planManifests(p *plan, ns string, files []string, priority int) error {
+	desired, err := manifestObjects(ns, files)
+	if err != nil {
+		return err
+	}
+	clusterScoped, err := getClusterScopedKinds()
+	if err != nil {
+		return err
+	}
+	if err := checkNamespaced(ns, desired, clusterScoped); err != nil {
+		return err
+	}
+	inventory, err := getManifestsInventory(ns)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]namespaceObject, len(desired))
+	refs := make([]string, 0, len(desired))
+	for _, obj := range desired {
+		current, err := getManifestObject(ns, obj)
+		if err != nil {
+			return err
+		}
+		existing[obj.manifestRef()] = current
+		refs = append(refs, obj.manifestRef())
+	}
+	sort.Strings(refs)
+	changes, err := diffManifests(desired, existing, inventory)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range changes.create {
+		if err := planServerSideApply(p, ns, obj, "created", create, priority); err != nil {
+			return err
+		}
+	}
+	for _, obj := range changes.update {
+		action := "updated, drifted fields: " + strings.Join(changes.drift[obj.manifestRef()], ", ")
+		if err := planServerSideApply(p, ns, obj, action, change, priority); err != nil {
+			return err
+		}
+	}
+	for _, ref := range changes.prune {
+		p.addDecision(fmt.Sprintf("[ %s ] in namespace [ %s ] is no longer in the manifests and will be DELETED", ref, ns), priority, remove)
+		p.addCommand(kubectl([]string{"delete", ref, "-n", ns, "--ignore-not-found", flags.getKubeDryRunFlag("delete")},
+			"Deleting [ "+ref+" ] in namespace [ "+ns+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
+	}
+
+	if strings.Join(inventory, "\n") == strings.Join(refs, "\n") {
+		return nil
+	}
+	if len(refs) == 0 {
+		p.addCommand(kubectl([]string{"delete", "configmap", manifestsInventoryName, "-n", ns, "--ignore-not-found", flags.getKubeDryRunFlag("delete")},
+			"Deleting the manifests inventory of namespace [ "+ns+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
+		return nil
+	}
+	file, err := writeManifest(manifestsInventory(ns, refs))
+	if err != nil {
+		return err
+	}
+	p.addCommand(kubectl([]string{"apply", "-f", file, "-n", ns, flags.getKubeDryRunFlag("apply")},
+		"Updating the manifests inventory of namespace [ "+ns+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
+	return nil
+}
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestManifest(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func Test_manifestObjects(t *testing.T) {
+	dir := t.TempDir()
+	file := writeTestManifest(t, dir, "objects.yaml", `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  labels:
+    app: shop
+data:
+  mode: fast
+---
+# empty documents are ignored
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: token
+  namespace: shop
+stringData:
+  token: secret
+---
+apiVersion: scheduling.k8s.io/v1
+kind: PriorityClass
+metadata:
+  name: high
+value: 1000
+`)
+	objects, err := manifestObjects("shop", []string{file})
+	if err != nil {
+		t.Fatalf("manifestObjects() unexpected error: %v", err)
+	}
+	var refs []string
+	for _, obj := range objects {
+		refs = append(refs, obj.manifestRef())
+	}
+	if want := []string{"configmap/settings", "secret/token", "priorityclass.v1.scheduling.k8s.io/high"}; !reflect.DeepEqual(refs, want) {
+		t.Fatalf("manifestObjects() refs = %v, want %v", refs, want)
+	}
+	labels := objects[0]["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	if labels["app"] != "shop" || labels["HELMSMAN_MANIFEST"] != "true" || labels["MANAGED-BY"] != nil {
+		t.Errorf("manifestObjects() labels = %v, want the manifest labels and the own ones", labels)
+	}
+	if _, ok := objects[1]["stringData"]; ok {
+		t.Errorf("manifestObjects() kept the stringData of a secret: %v", objects[1])
+	}
+	if got := objects[1]["data"].(map[string]interface{})["token"]; got != "c2VjcmV0" {
+		t.Errorf("manifestObjects() secret data = %v, want the base64 encoded stringData", got)
+	}
+}
+
+func Test_manifestObjects_substitutesInMemory(t *testing.T) {
+	substEnvValues := flags.substEnvValues
+	flags.substEnvValues = true
+	defer func() { flags.substEnvValues = substEnvValues }()
+	t.Setenv("HELMSMAN_TEST_TOKEN", "secret")
+	os.RemoveAll(tempFilesDir)
+
+	file := writeTestManifest(t, t.TempDir(), "secret.yaml", "apiVersion: v1\nkind: Secret\nmetadata:\n  name: token\nstringData:\n  token: $HELMSMAN_TEST_TOKEN\n")
+	files := resolveManifestPaths([]string{file}, filepath.Dir(file), t.TempDir())
+	objects, err := manifestObjects("shop", files)
+	if err != nil {
+		t.Fatalf("manifestObjects() unexpected error: %v", err)
+	}
+	if got := objects[0]["data"].(map[string]interface{})["token"]; got != "c2VjcmV0" {
+		t.Errorf("manifestObjects() secret data = %v, want the substituted env variable", got)
+	}
+	if _, err := os.Stat(tempFilesDir); !os.IsNotExist(err) {
+		t.Errorf("manifestObjects() wrote the substituted manifest to %s", tempFilesDir)
+	}
+}
+
+func Test_manifestObjects_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "missing kind",
+			content: "apiVersion: v1\nmetadata:\n  name: a\n",
+			wantErr: "must have an apiVersion, a kind and a metadata.name",
+		}, {
+			name:    "other namespace",
+			content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: other\n",
+			wantErr: "belongs to namespace [ other ]",
+		}, {
+			name:    "duplicate",
+			content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n",
+			wantErr: "object [ configmap/a ] is defined in both manifests",
+		}, {
+			name:    "inventory",
+			content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: helmsman-manifests\n",
+			wantErr: "is reserved for the inventory",
+		}, {
+			name:    "invalid yaml",
+			content: "apiVersion: [v1\n",
+			wantErr: "failed to parse manifest",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeTestManifest(t, t.TempDir(), "objects.yaml", tt.content)
+			_, err := manifestObjects("shop", []string{file})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("manifestObjects() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_diffManifests(t *testing.T) {
+	configMap := namespaceObject{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "labels": map[string]interface{}{"HELMSMAN_MANIFEST": "true"}},
+		"data":       map[string]interface{}{"mode": "fast"},
+	}
+	secret := namespaceObject{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "token"},
+		"data":       map[string]interface{}{"token": "c2VjcmV0"},
+	}
+	deployment := namespaceObject{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web"},
+	}
+	existing := map[string]namespaceObject{
+		"configmap/settings": {
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "settings", "uid": "1", "labels": map[string]interface{}{"HELMSMAN_MANIFEST": "true"}},
+			"data":       map[string]interface{}{"mode": "fast"},
+		},
+		"secret/token": {
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "token"},
+			"data":       map[string]interface{}{"token": "b2xk"},
+		},
+		"deployment.v1.apps/web": nil,
+	}
+	inventory := []string{"configmap/old", "configmap/settings", "secret/token"}
+
+	changes, err := diffManifests([]namespaceObject{configMap, secret, deployment}, existing, inventory)
+	if err != nil {
+		t.Fatalf("diffManifests() unexpected error: %v", err)
+	}
+	if len(changes.create) != 1 || changes.create[0].manifestRef() != "deployment.v1.apps/web" {
+		t.Errorf("diffManifests() create = %v, want the missing deployment", changes.create)
+	}
+	if len(changes.update) != 1 || changes.update[0].manifestRef() != "secret/token" {
+		t.Errorf("diffManifests() update = %v, want the drifted secret", changes.update)
+	}
+	if want := []string{"data.token"}; !reflect.DeepEqual(changes.drift["secret/token"], want) {
+		t.Errorf("diffManifests() drift = %v, want %v without the secret values", changes.drift["secret/token"], want)
+	}
+	if want := []string{"configmap/old"}; !reflect.DeepEqual(changes.prune, want) {
+		t.Errorf("diffManifests() prune = %v, want %v", changes.prune, want)
+	}
+}
+
+func Test_resolveManifestPaths(t *testing.T) {
+	if err := os.MkdirAll(tempFilesDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempFilesDir)
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "manifests"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestManifest(t, dir, "manifests/a.yaml", "kind: A\n")
+	writeTestManifest(t, dir, "manifests/b.yaml", "kind: B\n")
+	writeTestManifest(t, dir, "c.yaml", "kind: C\n")
+
+	files := resolveManifestPaths([]string{"manifests/*.yaml", "c.yaml"}, dir, t.TempDir())
+	var got []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+	}
+	if want := []string{"kind: A\n", "kind: B\n", "kind: C\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveManifestPaths() resolved files with %q, want %q", got, want)
+	}
+}
+
+func Test_checkNamespaced(t *testing.T) {
+	clusterScoped := parseAPIResources(`namespaces                        ns           v1                                false        Namespace
+priorityclasses                   pc           scheduling.k8s.io/v1              false        PriorityClass
+clusterroles                                   rbac.authorization.k8s.io/v1      false        ClusterRole
+`)
+	want := map[string]bool{"/Namespace": true, "scheduling.k8s.io/PriorityClass": true, "rbac.authorization.k8s.io/ClusterRole": true}
+	if !reflect.DeepEqual(clusterScoped, want) {
+		t.Fatalf("parseAPIResources() = %v, want %v", clusterScoped, want)
+	}
+
+	configMap := namespaceObject{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "settings"}}
+	if err := checkNamespaced("shop", []namespaceObject{configMap}, clusterScoped); err != nil {
+		t.Errorf("checkNamespaced() unexpected error: %v", err)
+	}
+	priorityClass := namespaceObject{"apiVersion": "scheduling.k8s.io/v1", "kind": "PriorityClass", "metadata": map[string]interface{}{"name": "high"}}
+	err := checkNamespaced("shop", []namespaceObject{configMap, priorityClass}, clusterScoped)
+	if err == nil || !strings.Contains(err.Error(), "[ priorityclass.v1.scheduling.k8s.io/high ] in the manifests of namespace [ shop ] is cluster-scoped") {
+		t.Errorf("checkNamespaced() error = %v, want the PriorityClass rejected", err)
+	}
+}
@@ -0,0 +1,498 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// The labels of the namespace objects Helmsman owns. Image pull secrets and the objects of the manifests get their own labels,
+// since MANAGED-BY=HELMSMAN also marks the helm release secrets and configmaps Helmsman manages.
+const (
+	// helmsmanOwnedLabel marks the namespace objects created by Helmsman, so they can be pruned when removed from the DSF
+	helmsmanOwnedLabel = "MANAGED-BY=HELMSMAN"
+	// helmsmanImagePullSecretLabel marks the image pull secrets created by Helmsman
+	helmsmanImagePullSecretLabel = "HELMSMAN_IMAGE_PULL_SECRET=true"
+	// helmsmanManifestLabel marks the objects applied from the manifests of a namespace
+	helmsmanManifestLabel = "HELMSMAN_MANIFEST=true"
+)
+
+const (
+	// helmsmanFieldManager is the field manager of the objects Helmsman applies server-side
+	helmsmanFieldManager = "helmsman"
+
+	// lastAppliedConfigAnnotation is where client-side apply keeps a copy of the applied object
+	lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// namespaceObject is a k8s object that Helmsman manages in a namespace, as a manifest
+type namespaceObject map[string]interface{}
+
+// newNamespaceObject builds the manifest of a Helmsman-owned object, fields are the top level fields besides the metadata, e.g. spec
+func newNamespaceObject(apiVersion, kind, ns, name string, fields map[string]interface{}) namespaceObject {
+	obj := namespaceObject{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": ns,
+			"labels":    helmsmanOwnedLabels(),
+		},
+	}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	return obj
+}
+
+func (o namespaceObject) name() string {
+	metadata, _ := o["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return name
+}
+
+func (o namespaceObject) kind() string {
+	kind, _ := o["kind"].(string)
+	return kind
+}
+
+// normalized returns the object as it decodes from JSON, so it can be compared with the objects read from the cluster
+func (o namespaceObject) normalized() (namespaceObject, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	var n namespaceObject
+	err = json.Unmarshal(data, &n)
+	return n, err
+}
+
+// namespaceObjectChanges are the changes needed to make the Helmsman-owned objects of a kind match the desired ones
+type namespaceObjectChanges struct {
+	create []namespaceObject
+	update []namespaceObject
+	prune  []string
+	// drift lists the fields of the updated objects that differ from the desired ones, keyed by object name
+	drift map[string][]string
+}
+
+// diffNamespaceObjects compares the desired objects with the existing ones.
+// An existing object is up to date when it contains all the desired fields with the same values, fields defaulted by k8s are ignored.
+func diffNamespaceObjects(desired []namespaceObject, existing map[string]namespaceObject) (namespaceObjectChanges, error) {
+	changes := namespaceObjectChanges{drift: make(map[string][]string)}
+	names := make(map[string]bool)
+	for _, obj := range desired {
+		names[obj.name()] = true
+		current, ok := existing[obj.name()]
+		if !ok {
+			changes.create = append(changes.create, obj)
+			continue
+		}
+		n, err := obj.normalized()
+		if err != nil {
+			return changes, err
+		}
+		if drift := driftFields(map[string]interface{}(n), map[string]interface{}(current), ""); len(drift) > 0 {
+			changes.update = append(changes.update, obj)
+			changes.drift[obj.name()] = drift
+		}
+	}
+	for _, name := range sortedKeys(existing) {
+		if !names[name] {
+			changes.prune = append(changes.prune, name)
+		}
+	}
+	return changes, nil
+}
+
+// isSubset checks if all the fields of desired are set in current with the same values.
+// Lists must have the same length and their items are compared one by one.
+func isSubset(desired, current interface{}) bool {
+	return len(driftFields(desired, current, "")) == 0
+}
+
+// driftFields returns the fields of desired that are not set in current with the same values, as "path: current -> desired",
+// e.g. after the object was edited manually. Fields of current that are not desired are ignored.
+func driftFields(desired, current interface{}, path string) []string {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		c, ok := current.(map[string]interface{})
+		if !ok {
+			if len(d) == 0 && current == nil {
+				return nil
+			}
+			return []string{fieldDrift(path, desired, current)}
+		}
+		var drift []string
+		for _, k := range sortedKeys(d) {
+			drift = append(drift, driftFields(d[k], c[k], strings.TrimPrefix(path+"."+k, "."))...)
+		}
+		return drift
+	case []interface{}:
+		c, ok := current.([]interface{})
+		if !ok {
+			if len(d) == 0 && current == nil {
+				return nil
+			}
+			return []string{fieldDrift(path, desired, current)}
+		}
+		if len(d) != len(c) {
+			return []string{fieldDrift(path, desired, current)}
+		}
+		var drift []string
+		for i := range d {
+			drift = append(drift, driftFields(d[i], c[i], fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return drift
+	default:
+		if reflect.DeepEqual(desired, current) || (quantityField.MatchString(path) && equalQuantities(desired, current)) {
+			return nil
+		}
+		return []string{fieldDrift(path, desired, current)}
+	}
+}
+
+// quantityField matches the paths of the fields holding resource quantities, which k8s returns in their canonical form, e.g. 500m for 0.5
+var quantityField = regexp.MustCompile(`^spec\.hard\.|^spec\.limits\[\d+\]\.(default|defaultRequest|max|min|maxLimitRequestRatio)\.|(^|\.)resources\.(limits|requests)\.`)
+
+// equalQuantities checks if two values are the same resource quantity, however they are written
+func equalQuantities(desired, current interface{}) bool {
+	d, ok := parseQuantity(desired)
+	if !ok {
+		return false
+	}
+	c, ok := parseQuantity(current)
+	return ok && d.Cmp(c) == 0
+}
+
+// parseQuantity parses a resource quantity written as a string or as a number
+func parseQuantity(v interface{}) (resource.Quantity, bool) {
+	var s string
+	switch q := v.(type) {
+	case string:
+		s = q
+	case float64:
+		s = strconv.FormatFloat(q, 'f', -1, 64)
+	default:
+		return resource.Quantity{}, false
+	}
+	quantity, err := resource.ParseQuantity(s)
+	return quantity, err == nil
+}
+
+// fieldDrift describes a field whose current value differs from the desired one
+func fieldDrift(path string, desired, current interface{}) string {
+	format := func(v interface{}) string {
+		if v == nil {
+			return "<unset>"
+		}
+		d, _ := json.Marshal(v)
+		return string(d)
+	}
+	return path + ": " + format(current) + " -> " + format(desired)
+}
+
+// ownedLabelSelector returns the label selector of the objects of a kind that Helmsman created for the current context
+func ownedLabelSelector(kind string) string {
+	owned := helmsmanOwnedLabel
+	if kind == "secret" {
+		owned = helmsmanImagePullSecretLabel
+	}
+	return owned + ",HELMSMAN_CONTEXT=" + curContext
+}
+
+// ownedLabels returns the labels of the objects of a kind that Helmsman creates
+func ownedLabels(kind string) map[string]string {
+	if kind != "secret" {
+		return helmsmanOwnedLabels()
+	}
+	key, value, _ := strings.Cut(helmsmanImagePullSecretLabel, "=")
+	return map[string]string{key: value, "HELMSMAN_CONTEXT": curContext}
+}
+
+// getHelmsmanOwnedManifests returns the objects of a kind that Helmsman created in a namespace for the current context, keyed by name
+func getHelmsmanOwnedManifests(kind, ns string) (map[string]namespaceObject, error) {
+	cmd := kubectl([]string{"get", kind, "-n", ns, "-l", ownedLabelSelector(kind), "-o", "json"},
+		"Getting Helmsman-owned "+kind+" objects in namespace [ "+ns+" ]")
+	res, err := cmd.Exec()
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s objects in namespace [ %s ]: %w", kind, ns, err)
+	}
+	var list struct {
+		Items []namespaceObject `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(res.output), &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the %s objects of namespace [ %s ]: %w", kind, ns, err)
+	}
+	objects := make(map[string]namespaceObject, len(list.Items))
+	for _, obj := range list.Items {
+		objects[obj.name()] = obj
+	}
+	return objects, nil
+}
+
+// planNamespaceObjects adds to the plan the decisions and commands needed to make the Helmsman-owned objects of a kind
+// in a namespace match the desired ones: desired objects are applied when missing or different, the others are deleted
+func planNamespaceObjects(p *plan, ns, kind string, desired []namespaceObject, priority int) error {
+	existing, err := getHelmsmanOwnedManifests(kind, ns)
+	if err != nil {
+		return err
+	}
+	return planNamespaceObjectChanges(p, ns, kind, desired, existing, priority)
+}
+
+// planNamespaceObjectChanges adds to the plan the changes needed to make the existing objects of a kind match the desired ones
+func planNamespaceObjectChanges(p *plan, ns, kind string, desired []namespaceObject, existing map[string]namespaceObject, priority int) error {
+	changes, err := diffNamespaceObjects(desired, existing)
+	if err != nil {
+		return err
+	}
+	for _, obj := range changes.create {
+		if err := planApply(p, ns, obj, "created", create, priority); err != nil {
+			return err
+		}
+	}
+	for _, obj := range changes.update {
+		drift := changes.drift[obj.name()]
+		if kind == "secret" {
+			// only show which fields of secrets changed, not their values
+			for i, d := range drift {
+				drift[i], _, _ = strings.Cut(d, ": ")
+			}
+		}
+		if field := immutableDrift(kind, drift); field != "" {
+			action := "RECREATED since its " + field + " can't be changed, drifted fields: " + strings.Join(drift, ", ")
+			if err := planReplace(p, ns, obj, action, priority); err != nil {
+				return err
+			}
+			continue
+		}
+		action := "updated, drifted fields: " + strings.Join(drift, ", ")
+		if err := planApply(p, ns, obj, action, change, priority); err != nil {
+			return err
+		}
+	}
+	if kind == "secret" {
+		for _, obj := range desired {
+			if current, ok := existing[obj.name()]; ok {
+				planRemoveLastAppliedConfiguration(p, ns, current, priority)
+			}
+		}
+	}
+	for _, name := range changes.prune {
+		p.addDecision(fmt.Sprintf("%s [ %s ] in namespace [ %s ] is no longer desired and will be DELETED", kind, name, ns), priority, remove)
+		p.addCommand(kubectl([]string{"delete", kind, name, "-n", ns, "--ignore-not-found", flags.getKubeDryRunFlag("delete")},
+			"Deleting "+kind+" [ "+name+" ] in namespace [ "+ns+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
+	}
+	return nil
+}
+
+// immutableFields are the fields k8s doesn't allow to change once an object is created, by kind
+var immutableFields = map[string][]string{
+	"rolebinding": {"roleRef"},
+}
+
+// immutableDrift returns the first immutable field of a kind among the drifted fields, or an empty string
+func immutableDrift(kind string, drift []string) string {
+	for _, field := range immutableFields[kind] {
+		for _, d := range drift {
+			if strings.HasPrefix(d, field+".") || strings.HasPrefix(d, field+":") || d == field {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// planReplace adds to the plan the decision and the command to delete and create an object again,
+// for changes of immutable fields that apply can't make
+func planReplace(p *plan, ns string, obj namespaceObject, action string, priority int) error {
+	file, err := writeObject(ns, obj)
+	if err != nil {
+		return err
+	}
+	p.addDecision(fmt.Sprintf("%s [ %s ] in namespace [ %s ] will be %s", obj.kind(), obj.name(), ns, action), priority, change)
+	p.addCommand(kubectl([]string{"replace", "--force", "--save-config", "-f", file, "-n", ns, flags.getKubeDryRunFlag("replace")},
+		"Recreating "+obj.kind()+" [ "+obj.name()+" ] in namespace [ "+ns+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
+	return nil
+}
+
+// planApply adds to the plan the decision and the command to apply an object.
+// Secrets are applied server-side, so their data is not copied to the last-applied-configuration annotation.
+func planApply(p *plan, ns string, obj namespaceObject, action string, decision decisionType, priority int) error {
+	if obj.kind() == "Secret" {
+		return planServerSideApply(p, ns, obj, action, decision, priority)
+	}
+	file, err := writeManifest(obj)
+	if err != nil {
+		return err
+	}
+	p.addDecision(fmt.Sprintf("%s [ %s ] in namespace [ %s ] will be %s", obj.kind(), obj.name(), ns, action), priority, decision)
+	p.addCommand(kubectl([]string{"apply", "-f", file, "-n", ns, flags.getKubeDryRunFlag("apply")},
+		"Applying "+obj.kind()+" [ "+obj.name()+" ] in namespace [ "+ns+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
+	return nil
+}
+
+// planServerSideApply adds to the plan the decision and the command to apply an object with server-side apply.
+// Conflicts are forced since the object is owned by Helmsman.
+func planServerSideApply(p *plan, ns string, obj namespaceObject, action string, decision decisionType, priority int) error {
+	file, err := writeObject(ns, obj)
+	if err != nil {
+		return err
+	}
+	p.addDecision(fmt.Sprintf("%s [ %s ] in namespace [ %s ] will be %s", obj.kind(), obj.name(), ns, action), priority, decision)
+	p.addCommand(kubectl([]string{"apply", "--server-side", "--field-manager", helmsmanFieldManager, "--force-conflicts",
+		"-f", file, "-n", ns, flags.getKubeDryRunFlag("apply")},
+		"Applying "+obj.kind()+" [ "+obj.name()+" ] in namespace [ "+ns+" ]"), priority, nil, []hookCmd{}, []hookCmd{})
+	return nil
+}
+
+// planRemoveLastAppliedConfiguration adds to the plan the removal of the last-applied-configuration annotation of a secret,
+// which holds a copy of its data when it was applied client-side by a previous version of Helmsman
+func planRemoveLastAppliedConfiguration(p *plan, ns string, current namespaceObject, priority int) {
+	metadata, _ := current["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if _, ok := annotations[lastAppliedConfigAnnotation]; !ok {
+		return
+	}
+	name := current.name()
+	p.addDecision(fmt.Sprintf("Secret [ %s ] in namespace [ %s ] will be updated to remove its %s annotation, which holds a copy of its data",
+		name, ns, lastAppliedConfigAnnotation), priority, change)
+	p.addCommand(kubectl([]string{"annotate", "secret", name, lastAppliedConfigAnnotation + "-", "-n", ns, flags.getKubeDryRunFlag("annotate")},
+		"Removing the "+lastAppliedConfigAnnotation+" annotation of secret [ "+name+" ] in namespace [ "+ns+" ]"),
+		priority, nil, []hookCmd{}, []hookCmd{})
+}
+
+// writeObject writes an object for kubectl to apply it. Secrets are written to the private directory of the decrypted secrets
+// instead of the temp files, since they hold credentials.
+func writeObject(ns string, obj namespaceObject) (string, error) {
+	if obj.kind() != "Secret" {
+		return writeManifest(obj)
+	}
+	d, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return decrypted.writePrivate(filepath.Join(ns, "secret-"+obj.name()+".yaml"), string(d))
+}
+
+// writeManifest writes an object to a temp file, for kubectl to apply it
+func writeManifest(obj namespaceObject) (string, error) {
+	d, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(tempFilesDir, strings.ToLower(obj.kind())+"-*.yaml")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(d); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// defaultNamespaceObjectsPriority is the priority of the namespace objects in the plan, they are applied before the releases
+// and before untracked releases are deleted
+const defaultNamespaceObjectsPriority = -900
+
+// namespaceObjectsPriority returns the priority of the namespace objects in the plan, lower than the one of any release
+func (s *State) namespaceObjectsPriority() int {
+	priority := defaultNamespaceObjectsPriority
+	for _, r := range s.Apps {
+		if r.Priority <= priority {
+			priority = r.Priority - 1
+		}
+	}
+	return priority
+}
+
+// planNamespaces adds to the plan the changes of the namespaces and of the objects Helmsman manages in them.
+// Namespaces are created, labeled and annotated before their objects are applied.
+// If --ns-override flag is used, it only creates the provided namespace in that flag
+func (s *State) planNamespaces(p *plan) {
+	priority := s.namespaceObjectsPriority()
+	if flags.nsOverride != "" {
+		if _, err := s.planNamespace(p, flags.nsOverride, nil, priority-1); err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	}
+	for _, name := range sortedKeys(s.Namespaces) {
+		ns := s.Namespaces[name]
+		if ns.disabled {
+			continue
+		}
+		exists, err := s.planNamespace(p, name, ns, priority-1)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		if !exists && flags.dryRun {
+			p.addDecision("Namespace [ "+name+" ] does not exist yet. Its objects are not checked in dry-run.", priority, noop)
+			continue
+		}
+		if err := s.planNamespaceObjects(p, name, ns, priority); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	if s.Settings.NamespacesAuthoritative {
+		s.planNamespaceDeletions(p)
+	}
+}
+
+// planNamespaceObjects adds to the plan the changes of the limits, quotas, network policies, image pull secrets, RBAC objects and manifests of a namespace
+func (s *State) planNamespaceObjects(p *plan, name string, ns *Namespace, priority int) error {
+	kinds, err := ns.objectsByKind(name)
+	if err != nil {
+		return err
+	}
+	for _, k := range kinds {
+		if err := planNamespaceObjects(p, name, k.kind, k.objects, priority); err != nil {
+			return err
+		}
+	}
+	if err := planDefaultServiceAccount(p, name, ns.ImagePullSecrets, priority); err != nil {
+		return err
+	}
+	if ns.Protected.Value && ns.RBAC != nil {
+		p.addDecision("Namespace [ "+name+" ] is PROTECTED. Its RBAC objects are not changed.", priority, noop)
+	}
+	return planManifests(p, name, ns.Manifests, priority)
+}
+
+// namespaceObjects are the desired Helmsman-owned objects of a kind in a namespace
+type namespaceObjects struct {
+	kind    string
+	objects []namespaceObject
+}
+
+// objectsByKind returns the desired Helmsman-owned objects of a namespace, in the order they are applied.
+// The RBAC objects of a protected namespace are left out, so they are neither changed nor deleted.
+func (ns *Namespace) objectsByKind(name string) ([]namespaceObjects, error) {
+	secrets, err := imagePullSecretObjects(name, ns.ImagePullSecrets)
+	if err != nil {
+		return nil, err
+	}
+	kinds := []namespaceObjects{
+		{"limitrange", limitRangeObjects(name, ns.Limits)},
+		{"resourcequota", resourceQuotaObjects(name, ns.Quotas)},
+		{"networkpolicy", ns.NetworkPolicies.objects(name)},
+		{"secret", secrets},
+	}
+	if ns.Protected.Value && ns.RBAC != nil {
+		return kinds, nil
+	}
+	roles, bindings := ns.RBAC.objects(name)
+	return append(kinds, namespaceObjects{"role", roles}, namespaceObjects{"rolebinding", bindings}), nil
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_isSubset(t *testing.T) {
+	current := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"podSelector": map[string]interface{}{},
+			"policyTypes": []interface{}{"Ingress"},
+			"ingress":     []interface{}{map[string]interface{}{"from": []interface{}{map[string]interface{}{"podSelector": map[string]interface{}{}}}}},
+		},
+		"metadata": map[string]interface{}{"name": "np", "uid": "1234"},
+	}
+	tests := []struct {
+		name    string
+		desired map[string]interface{}
+		want    bool
+	}{
+		{name: "same fields", desired: map[string]interface{}{"spec": map[string]interface{}{"policyTypes": []interface{}{"Ingress"}}}, want: true},
+		{name: "defaulted fields are ignored", desired: map[string]interface{}{"metadata": map[string]interface{}{"name": "np"}}, want: true},
+		{name: "empty selector", desired: map[string]interface{}{"spec": map[string]interface{}{"podSelector": map[string]interface{}{}}}, want: true},
+		{name: "different value", desired: map[string]interface{}{"spec": map[string]interface{}{"policyTypes": []interface{}{"Egress"}}}, want: false},
+		{name: "different list length", desired: map[string]interface{}{"spec": map[string]interface{}{"policyTypes": []interface{}{"Ingress", "Egress"}}}, want: false},
+		{name: "missing field", desired: map[string]interface{}{"spec": map[string]interface{}{"egress": []interface{}{"x"}}}, want: false},
+	}
+	for _, tt := range tests {
+		if got := isSubset(tt.desired, current); got != tt.want {
+			t.Errorf("isSubset() %s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_diffNamespaceObjects(t *testing.T) {
+	curContext = "test-ctx"
+	binding := func(role string) namespaceObject {
+		return newNamespaceObject(rbacAPIVersion, "RoleBinding", "staging", "team-a", map[string]interface{}{
+			"roleRef": map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": "ClusterRole", "name": role},
+		})
+	}
+	// existing objects are read from kubectl as JSON, with extra fields set by k8s
+	var current namespaceObject
+	data, _ := json.Marshal(binding("edit"))
+	if err := json.Unmarshal(data, &current); err != nil {
+		t.Fatal(err)
+	}
+	current["metadata"].(map[string]interface{})["resourceVersion"] = "42"
+	existing := map[string]namespaceObject{"team-a": current, "old-binding": {}}
+
+	changes, err := diffNamespaceObjects([]namespaceObject{binding("edit")}, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.create) != 0 || len(changes.update) != 0 || !reflect.DeepEqual(changes.prune, []string{"old-binding"}) {
+		t.Errorf("diffNamespaceObjects() = %+v, want only old-binding to be pruned", changes)
+	}
+
+	changes, _ = diffNamespaceObjects([]namespaceObject{binding("view")}, existing)
+	if len(changes.update) != 1 {
+		t.Errorf("diffNamespaceObjects() = %+v, want team-a to be updated", changes)
+	}
+	if want := []string{`roleRef.name: "edit" -> "view"`}; !reflect.DeepEqual(changes.drift["team-a"], want) {
+		t.Errorf("diffNamespaceObjects() drift = %v, want %v", changes.drift["team-a"], want)
+	}
+
+	changes, _ = diffNamespaceObjects([]namespaceObject{binding("view")}, map[string]namespaceObject{})
+	if len(changes.create) != 1 || len(changes.prune) != 0 {
+		t.Errorf("diffNamespaceObjects() = %+v, want team-a to be created", changes)
+	}
+}
+
+func Test_driftFields(t *testing.T) {
+	// a ResourceQuota edited manually
+	current := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"hard": map[string]interface{}{"pods": "20", "limits.cpu": "4"},
+		},
+		"metadata": map[string]interface{}{"name": "resource-quota", "uid": "1234"},
+	}
+	desired := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"hard": map[string]interface{}{"pods": "10", "limits.cpu": "4", "requests.memory": "1Gi"},
+		},
+		"metadata": map[string]interface{}{"name": "resource-quota"},
+	}
+	want := []string{`spec.hard.pods: "20" -> "10"`, `spec.hard.requests.memory: <unset> -> "1Gi"`}
+	if got := driftFields(desired, current, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("driftFields() = %v, want %v", got, want)
+	}
+
+	limits := map[string]interface{}{"limits": []interface{}{map[string]interface{}{"type": "Container"}}}
+	want = []string{`limits[0].type: "Pod" -> "Container"`}
+	if got := driftFields(limits, map[string]interface{}{"limits": []interface{}{map[string]interface{}{"type": "Pod"}}}, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("driftFields() = %v, want %v", got, want)
+	}
+	want = []string{`limits: [{"type":"Pod"},{"type":"Pod"}] -> [{"type":"Container"}]`}
+	pods := []interface{}{map[string]interface{}{"type": "Pod"}, map[string]interface{}{"type": "Pod"}}
+	if got := driftFields(limits, map[string]interface{}{"limits": pods}, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("driftFields() = %v, want %v", got, want)
+	}
+}
+
+func Test_driftFields_quantities(t *testing.T) {
+	// k8s returns the quantities in their canonical form
+	current := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"hard": map[string]interface{}{"limits.cpu": "500m", "requests.memory": "1Gi", "pods": "10"},
+			"limits": []interface{}{map[string]interface{}{
+				"type":    "Container",
+				"default": map[string]interface{}{"cpu": "1500m", "memory": "512Mi"},
+			}},
+		},
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"version": "0.5"}},
+	}
+	desired := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"hard": map[string]interface{}{"limits.cpu": "0.5", "requests.memory": "1024Mi", "pods": "20"},
+			"limits": []interface{}{map[string]interface{}{
+				"type":    "Container",
+				"default": map[string]interface{}{"cpu": 1.5, "memory": "0.5Gi"},
+			}},
+		},
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"version": "500m"}},
+	}
+	want := []string{`metadata.labels.version: "0.5" -> "500m"`, `spec.hard.pods: "10" -> "20"`}
+	if got := driftFields(desired, current, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("driftFields() = %v, want %v", got, want)
+	}
+}
+
+func Test_State_namespaceObjectsPriority(t *testing.T) {
+	s := State{Apps: map[string]*Release{"a": {Priority: -3}, "b": {}}}
+	if got := s.namespaceObjectsPriority(); got != defaultNamespaceObjectsPriority {
+		t.Errorf("namespaceObjectsPriority() = %d, want %d", got, defaultNamespaceObjectsPriority)
+	}
+	s.Apps["c"] = &Release{Priority: -1000}
+	if got := s.namespaceObjectsPriority(); got != -1001 {
+		t.Errorf("namespaceObjectsPriority() = %d, want -1001", got)
+	}
+}
+
+func Test_planApply_secret(t *testing.T) {
+	defer decrypted.remove()
+	p := createPlan()
+	secret := newNamespaceObject("v1", "Secret", "shop", "registry", map[string]interface{}{
+		"type": "kubernetes.io/dockerconfigjson",
+		"data": map[string]interface{}{".dockerconfigjson": "c2VjcmV0"},
+	})
+	if err := planApply(p, "shop", secret, "created", create, 0); err != nil {
+		t.Fatalf("planApply() unexpected error: %v", err)
+	}
+	if len(p.Commands) != 1 {
+		t.Fatalf("planApply() added %d commands, want 1", len(p.Commands))
+	}
+	args := strings.Join(p.Commands[0].Command.Args, " ")
+	if !strings.Contains(args, "--server-side --field-manager helmsman") {
+		t.Errorf("planApply() command = %s, want a server-side apply", args)
+	}
+	file := p.Commands[0].Command.Args[6]
+	if filepath.Dir(file) != decrypted.dir {
+		t.Errorf("planApply() wrote the secret to %s, want it in the private directory %s", file, decrypted.dir)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("planApply() wrote the secret with mode %v, want 0600", info.Mode().Perm())
+	}
+	if redactions.redact("registry") != "registry" {
+		t.Errorf("planApply() redacted the fields of the secret manifest")
+	}
+}
+
+func Test_planRemoveLastAppliedConfiguration(t *testing.T) {
+	p := createPlan()
+	current := namespaceObject{"metadata": map[string]interface{}{"name": "registry"}}
+	planRemoveLastAppliedConfiguration(p, "shop", current, 0)
+	if len(p.Commands) != 0 {
+		t.Errorf("planRemoveLastAppliedConfiguration() added commands for a secret without the annotation: %v", p.Commands)
+	}
+	current["metadata"].(map[string]interface{})["annotations"] = map[string]interface{}{lastAppliedConfigAnnotation: "{}"}
+	planRemoveLastAppliedConfiguration(p, "shop", current, 0)
+	if len(p.Commands) != 1 || !reflect.DeepEqual(p.Commands[0].Command.Args[:3], []string{"annotate", "secret", "registry"}) {
+		t.Errorf("planRemoveLastAppliedConfiguration() commands = %v, want the annotation removed", p.Commands)
+	}
+}
+
+func Test_Namespace_objectsByKind(t *testing.T) {
+	defer redactions.reset()
+	ns := &Namespace{
+		RBAC: &RBAC{Bindings: map[string]*RoleBinding{"team-a-edit": {ClusterRole: "edit", Groups: []string{"team-a"}}}},
+		ImagePullSecrets: map[string]*ImagePullSecret{
+			"ghcr": {Registry: "ghcr.io", Username: "ci", Password: "s3cr3t-token", PatchDefaultServiceAccount: true},
+		},
+	}
+	kinds := func() []string {
+		objects, err := ns.objectsByKind("shop")
+		if err != nil {
+			t.Fatalf("objectsByKind() unexpected error: %v", err)
+		}
+		var got []string
+		for _, k := range objects {
+			if len(k.objects) > 0 {
+				got = append(got, k.kind)
+			}
+		}
+		return got
+	}
+	if got, want := kinds(), []string{"secret", "rolebinding"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("objectsByKind() kinds = %v, want %v", got, want)
+	}
+	ns.Protected = True
+	if got, want := kinds(), []string{"secret"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("objectsByKind() kinds of a protected namespace = %v, want the image pull secrets without the RBAC objects", got)
+	}
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dario.cat/mergo"
+)
+
+// resolveNamespaceTemplates applies the namespaceTemplates referenced with the template field to the namespaces.
+// Templates are applied in the order they are listed and the namespace's own settings are applied last.
+// Maps are deep merged and slices are appended.
+func (s *State) resolveNamespaceTemplates() error {
+	resolved := make(map[string]*Namespace)
+	names := make([]string, 0, len(s.Namespaces))
+	for name := range s.Namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ns := s.Namespaces[name]
+		if ns == nil || len(ns.Template) == 0 {
+			continue
+		}
+		base, err := s.namespaceTemplatesBase(ns.Template, resolved, nil)
+		if err != nil {
+			return fmt.Errorf("namespace [ %s ]: %w", name, err)
+		}
+		if err := mergeNamespace(base, ns.clone()); err != nil {
+			return fmt.Errorf("namespace [ %s ]: failed to apply templates: %w", name, err)
+		}
+		// the templates are never inherited
+		base.Template = ns.Template
+		*ns = *base
+	}
+	return nil
+}
+
+// namespaceTemplatesBase merges the given templates, in order, into a new namespace
+func (s *State) namespaceTemplatesBase(names []string, resolved map[string]*Namespace, chain []string) (*Namespace, error) {
+	base := &Namespace{}
+	for _, name := range names {
+		tpl, err := s.getNamespaceTemplate(name, resolved, chain)
+		if err != nil {
+			return nil, err
+		}
+		if err := mergeNamespace(base, tpl.clone()); err != nil {
+			return nil, fmt.Errorf("failed to apply template [ %s ]: %w", name, err)
+		}
+	}
+	return base, nil
+}
+
+// getNamespaceTemplate returns a namespaceTemplate with the templates it inherits from applied
+func (s *State) getNamespaceTemplate(name string, resolved map[string]*Namespace, chain []string) (*Namespace, error) {
+	if tpl, ok := resolved[name]; ok {
+		return tpl, nil
+	}
+	if stringInSlice(name, chain) {
+		return nil, fmt.Errorf("namespaceTemplates have a cycle: %s", strings.Join(append(chain, name), " -> "))
+	}
+	tpl, ok := s.NamespaceTemplates[name]
+	if !ok || tpl == nil {
+		return nil, fmt.Errorf("template [ %s ] is not defined in namespaceTemplates", name)
+	}
+
+	result := tpl.clone()
+	if len(tpl.Template) > 0 {
+		base, err := s.namespaceTemplatesBase(tpl.Template, resolved, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+		if err := mergeNamespace(base, result); err != nil {
+			return nil, fmt.Errorf("failed to apply templates to template [ %s ]: %w", name, err)
+		}
+		result = base
+	}
+	resolved[name] = result
+	return result, nil
+}
+
+// mergeNamespace merges src into dst, custom network policies and hooks of the defaults are deep merged
+func mergeNamespace(dst, src *Namespace) error {
+	var custom map[string]map[string]interface{}
+	if dst.NetworkPolicies != nil && src.NetworkPolicies != nil && len(src.NetworkPolicies.Custom) > 0 {
+		custom = make(map[string]map[string]interface{})
+		for name, spec := range dst.NetworkPolicies.Custom {
+			custom[name] = copyValues(spec)
+		}
+		for name, spec := range src.NetworkPolicies.Custom {
+			custom[name] = mergeValues(copyValues(custom[name]), copyValues(spec))
+		}
+	}
+	var hooks map[string]interface{}
+	if dst.Defaults != nil && src.Defaults != nil && (len(dst.Defaults.Hooks) > 0 || len(src.Defaults.Hooks) > 0) {
+		hooks = mergeValues(copyValues(dst.Defaults.Hooks), copyValues(src.Defaults.Hooks))
+	}
+	if err := mergo.Merge(dst, src,
+		mergo.WithAppendSlice,
+		mergo.WithOverride,
+		mergo.WithTransformers(MergoTransformer(NullBoolTransformer))); err != nil {
+		return err
+	}
+	if custom != nil {
+		dst.NetworkPolicies.Custom = custom
+	}
+	if hooks != nil {
+		dst.Defaults.Hooks = hooks
+	}
+	return nil
+}
+
+// clone returns a copy of the namespace that does not share maps, slices or pointers with it
+func (n *Namespace) clone() *Namespace {
+	c := *n
+	c.Template = append(StringList(nil), n.Template...)
+	c.Limits = append(Limits(nil), n.Limits...)
+	c.Labels = copyStringMap(n.Labels)
+	c.Annotations = copyStringMap(n.Annotations)
+	c.Manifests = append([]string(nil), n.Manifests...)
+	if n.Quotas != nil {
+		q := *n.Quotas
+		q.CustomQuotas = append([]CustomResource(nil), n.Quotas.CustomQuotas...)
+		c.Quotas = &q
+	}
+	if n.NetworkPolicies != nil {
+		c.NetworkPolicies = &NetworkPolicies{
+			Presets: append([]string(nil), n.NetworkPolicies.Presets...),
+			Custom:  copyNetworkPolicies(n.NetworkPolicies.Custom),
+		}
+	}
+	if n.RBAC != nil {
+		rbac := &RBAC{}
+		if n.RBAC.Roles != nil {
+			rbac.Roles = make(map[string][]PolicyRule, len(n.RBAC.Roles))
+			for name, rules := range n.RBAC.Roles {
+				rbac.Roles[name] = append([]PolicyRule(nil), rules...)
+			}
+		}
+		if n.RBAC.Bindings != nil {
+			rbac.Bindings = make(map[string]*RoleBinding, len(n.RBAC.Bindings))
+			for name, b := range n.RBAC.Bindings {
+				if b == nil {
+					rbac.Bindings[name] = nil
+					continue
+				}
+				binding := *b
+				binding.Groups = append([]string(nil), b.Groups...)
+				binding.Users = append([]string(nil), b.Users...)
+				binding.ServiceAccounts = append([]string(nil), b.ServiceAccounts...)
+				rbac.Bindings[name] = &binding
+			}
+		}
+		c.RBAC = rbac
+	}
+	if n.Defaults != nil {
+		d := *n.Defaults
+		d.HelmFlags = append([]string(nil), n.Defaults.HelmFlags...)
+		d.ValuesFiles = append([]string(nil), n.Defaults.ValuesFiles...)
+		if n.Defaults.Hooks != nil {
+			d.Hooks = copyValues(n.Defaults.Hooks)
+		}
+		c.Defaults = &d
+	}
+	if n.PodSecurity != nil {
+		ps := *n.PodSecurity
+		c.PodSecurity = &ps
+	}
+	if n.ImagePullSecrets != nil {
+		c.ImagePullSecrets = make(map[string]*ImagePullSecret, len(n.ImagePullSecrets))
+		for name, ips := range n.ImagePullSecrets {
+			if ips == nil {
+				c.ImagePullSecrets[name] = nil
+				continue
+			}
+			secret := *ips
+			c.ImagePullSecrets[name] = &secret
+		}
+	}
+	return &c
+}
+
+func copyNetworkPolicies(custom map[string]map[string]interface{}) map[string]map[string]interface{} {
+	if custom == nil {
+		return nil
+	}
+	c := make(map[string]map[string]interface{}, len(custom))
+	for name, spec := range custom {
+		c[name] = copyValues(spec)
+	}
+	return c
+}
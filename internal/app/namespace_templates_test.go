@@ -0,0 +1,159 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_state_resolveNamespaceTemplates(t *testing.T) {
+	s := &State{
+		NamespaceTemplates: map[string]*Namespace{
+			"base": {
+				Labels: map[string]string{"team": "platform", "env": "dev"},
+				Limits: Limits{{Type: "Container", Default: Resources{CPU: "300m"}}},
+				Quotas: &Quotas{Pods: "10", CPULimits: "10"},
+				NetworkPolicies: &NetworkPolicies{
+					Custom: map[string]map[string]interface{}{
+						"allow-dns": {"policyTypes": []interface{}{"Egress"}, "podSelector": map[string]interface{}{}},
+					},
+				},
+				Defaults: &NamespaceDefaults{Wait: True, Hooks: map[string]interface{}{"successTimeout": "90s"}},
+			},
+			"prod": {
+				Template:    StringList{"base"},
+				Labels:      map[string]string{"env": "prod"},
+				PodSecurity: &PodSecurity{Enforce: "restricted"},
+			},
+		},
+		Namespaces: map[string]*Namespace{
+			"shop": {
+				Template:    StringList{"prod"},
+				Annotations: map[string]string{"owner": "shop"},
+				Quotas:      &Quotas{Pods: "20"},
+				Defaults:    &NamespaceDefaults{Timeout: 600, Hooks: map[string]interface{}{"deleteOnSuccess": true}},
+			},
+			"plain": {Labels: map[string]string{"team": "plain"}},
+		},
+	}
+	if err := s.resolveNamespaceTemplates(); err != nil {
+		t.Fatalf("resolveNamespaceTemplates() unexpected error: %v", err)
+	}
+
+	want := &Namespace{
+		Template:    StringList{"prod"},
+		Labels:      map[string]string{"team": "platform", "env": "prod"},
+		Annotations: map[string]string{"owner": "shop"},
+		Limits:      Limits{{Type: "Container", Default: Resources{CPU: "300m"}}},
+		Quotas:      &Quotas{Pods: "20", CPULimits: "10"},
+		NetworkPolicies: &NetworkPolicies{
+			Custom: map[string]map[string]interface{}{
+				"allow-dns": {"policyTypes": []interface{}{"Egress"}, "podSelector": map[string]interface{}{}},
+			},
+		},
+		Defaults: &NamespaceDefaults{
+			Wait:    True,
+			Timeout: 600,
+			Hooks:   map[string]interface{}{"successTimeout": "90s", "deleteOnSuccess": true},
+		},
+		PodSecurity: &PodSecurity{Enforce: "restricted"},
+	}
+	if got := s.Namespaces["shop"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveNamespaceTemplates() = %+v, want %+v", got, want)
+	}
+	if got := s.Namespaces["plain"]; !reflect.DeepEqual(got, &Namespace{Labels: map[string]string{"team": "plain"}}) {
+		t.Errorf("resolveNamespaceTemplates() changed a namespace without templates: %+v", got)
+	}
+	base := s.NamespaceTemplates["base"]
+	if base.Labels["env"] != "dev" || base.Quotas.Pods != "10" || len(base.Defaults.Hooks) != 1 {
+		t.Errorf("resolveNamespaceTemplates() modified the base template: %+v", base)
+	}
+}
+
+func Test_state_resolveNamespaceTemplates_protected(t *testing.T) {
+	s := &State{
+		NamespaceTemplates: map[string]*Namespace{"locked": {Protected: True}},
+		Namespaces: map[string]*Namespace{
+			"unlocked": {Template: StringList{"locked"}, Protected: False},
+			"inherits": {Template: StringList{"locked"}},
+		},
+	}
+	if err := s.resolveNamespaceTemplates(); err != nil {
+		t.Fatalf("resolveNamespaceTemplates() unexpected error: %v", err)
+	}
+	if got := s.Namespaces["unlocked"].Protected; got != False {
+		t.Errorf("resolveNamespaceTemplates() protected = %+v, want the namespace value %+v to win over the template", got, False)
+	}
+	if got := s.Namespaces["inherits"].Protected; got != True {
+		t.Errorf("resolveNamespaceTemplates() protected = %+v, want the template value %+v", got, True)
+	}
+}
+
+func Test_state_resolveNamespaceTemplates_errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]*Namespace
+		wantErr   string
+	}{
+		{
+			name:      "missing template",
+			templates: map[string]*Namespace{},
+			wantErr:   "template [ a ] is not defined in namespaceTemplates",
+		}, {
+			name: "cycle",
+			templates: map[string]*Namespace{
+				"a": {Template: StringList{"b"}},
+				"b": {Template: StringList{"a"}},
+			},
+			wantErr: "a -> b -> a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &State{
+				NamespaceTemplates: tt.templates,
+				Namespaces:         map[string]*Namespace{"ns": {Template: StringList{"a"}}},
+			}
+			err := s.resolveNamespaceTemplates()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolveNamespaceTemplates() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_build_resolvesNamespaceTemplatesAcrossFiles(t *testing.T) {
+	teardownTestCase, err := setupStateFileTestCase(t)
+	if err != nil {
+		t.Errorf("setupStateFileTestCase(), got: %v", err)
+	}
+	defer teardownTestCase(t)
+
+	dir := t.TempDir()
+	files := []struct{ name, content string }{
+		{"templates.toml", "[namespaceTemplates.team]\nlabels = { team = \"shop\" }\n[namespaceTemplates.team.podSecurity]\nenforce = \"baseline\"\n"},
+		{"namespaces.yaml", "namespaces:\n  shop:\n    template: team\n    labels:\n      env: prod\n"},
+	}
+	var fileOptions fileOptionArray
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fileOptions = append(fileOptions, fileOption{name: path})
+	}
+
+	s := new(State)
+	if err := s.build(fileOptions); err != nil {
+		t.Fatalf("build() - unexpected error: %v", err)
+	}
+	ns := s.Namespaces["shop"]
+	if !reflect.DeepEqual(ns.Labels, map[string]string{"team": "shop", "env": "prod"}) || ns.PodSecurity == nil || ns.PodSecurity.Enforce != "baseline" {
+		t.Errorf("build() - namespace did not inherit its template: %+v", ns)
+	}
+	if err := ns.validate(); err != nil {
+		t.Errorf("validate() - unexpected error for the resolved namespace: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	networkPolicyDenyIngress        = "default-deny-ingress"
+	networkPolicyDenyEgress         = "default-deny-egress"
+	networkPolicyAllowSameNamespace = "allow-same-namespace"
+	networkPolicyAllowDNS           = "allow-dns"
+)
+
+// dns1123Name matches the valid names of k8s objects
+var dns1123Name = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// networkPolicyPresets are the specs of the built-in network policies
+var networkPolicyPresets = map[string]map[string]interface{}{
+	networkPolicyDenyIngress: {
+		"podSelector": map[string]interface{}{},
+		"policyTypes": []string{"Ingress"},
+	},
+	networkPolicyDenyEgress: {
+		"podSelector": map[string]interface{}{},
+		"policyTypes": []string{"Egress"},
+	},
+	networkPolicyAllowSameNamespace: {
+		"podSelector": map[string]interface{}{},
+		"policyTypes": []string{"Ingress"},
+		"ingress": []interface{}{
+			map[string]interface{}{"from": []interface{}{map[string]interface{}{"podSelector": map[string]interface{}{}}}},
+		},
+	},
+	networkPolicyAllowDNS: {
+		"podSelector": map[string]interface{}{},
+		"policyTypes": []string{"Egress"},
+		"egress": []interface{}{
+			map[string]interface{}{
+				"to": []interface{}{map[string]interface{}{
+					"namespaceSelector": map[string]interface{}{},
+					"podSelector":       map[string]interface{}{"matchLabels": map[string]string{"k8s-app": "kube-dns"}},
+				}},
+				"ports": []interface{}{
+					map[string]interface{}{"protocol": "UDP", "port": 53},
+					map[string]interface{}{"protocol": "TCP", "port": 53},
+				},
+			},
+		},
+	},
+}
+
+// NetworkPolicies type represents the network policies Helmsman manages in a namespace
+type NetworkPolicies struct {
+	// Presets is a list of built-in policies: default-deny-ingress, default-deny-egress, allow-same-namespace and allow-dns
+	Presets []string `json:"presets,omitempty"`
+	// Custom policies, keyed by name, their value is the spec of a NetworkPolicy object
+	Custom map[string]map[string]interface{} `json:"custom,omitempty"`
+}
+
+// validate validates the presets and the names of the custom policies
+func (np *NetworkPolicies) validate() error {
+	if np == nil {
+		return nil
+	}
+	for _, p := range np.Presets {
+		if _, ok := networkPolicyPresets[p]; !ok {
+			return fmt.Errorf("unknown network policy preset [ %s ], valid presets are: %s", p, strings.Join(sortedKeys(networkPolicyPresets), ", "))
+		}
+	}
+	for name, spec := range np.Custom {
+		if !dns1123Name.MatchString(name) {
+			return fmt.Errorf("network policy name [ %s ] is not a valid k8s object name", name)
+		}
+		if _, ok := networkPolicyPresets[name]; ok && stringInSlice(name, np.Presets) {
+			return fmt.Errorf("network policy [ %s ] is defined both as a preset and as a custom policy", name)
+		}
+		if len(spec) == 0 {
+			return fmt.Errorf("network policy [ %s ] has an empty spec", name)
+		}
+	}
+	return nil
+}
+
+// specs returns the specs of the desired network policies, keyed by name
+func (np *NetworkPolicies) specs() map[string]map[string]interface{} {
+	specs := make(map[string]map[string]interface{})
+	if np == nil {
+		return specs
+	}
+	for _, p := range np.Presets {
+		specs[p] = networkPolicyPresets[p]
+	}
+	for name, spec := range np.Custom {
+		specs[name] = spec
+	}
+	return specs
+}
+
+// objects returns the desired NetworkPolicy objects of a namespace
+func (np *NetworkPolicies) objects(ns string) []namespaceObject {
+	var objects []namespaceObject
+	specs := np.specs()
+	for _, name := range sortedKeys(specs) {
+		objects = append(objects, newNamespaceObject("networking.k8s.io/v1", "NetworkPolicy", ns, name, map[string]interface{}{
+			"spec": specs[name],
+		}))
+	}
+	return objects
+}
+
+// helmsmanOwnedLabels returns the labels of the namespace objects created by Helmsman
+func helmsmanOwnedLabels() map[string]string {
+	key, value, _ := strings.Cut(helmsmanOwnedLabel, "=")
+	return map[string]string{key: value, "HELMSMAN_CONTEXT": curContext}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func Test_NetworkPolicies_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		np      *NetworkPolicies
+		wantErr bool
+	}{
+		{name: "nil", np: nil},
+		{name: "presets", np: &NetworkPolicies{Presets: []string{networkPolicyDenyIngress, networkPolicyAllowDNS}}},
+		{name: "unknown preset", np: &NetworkPolicies{Presets: []string{"deny-all"}}, wantErr: true},
+		{name: "custom", np: &NetworkPolicies{Custom: map[string]map[string]interface{}{"allow-ingress-nginx": {"podSelector": map[string]interface{}{}}}}},
+		{name: "invalid custom name", np: &NetworkPolicies{Custom: map[string]map[string]interface{}{"Allow_All": {"podSelector": map[string]interface{}{}}}}, wantErr: true},
+		{name: "empty custom spec", np: &NetworkPolicies{Custom: map[string]map[string]interface{}{"allow-all": {}}}, wantErr: true},
+		{
+			name: "custom clashing with a preset",
+			np: &NetworkPolicies{
+				Presets: []string{networkPolicyAllowDNS},
+				Custom:  map[string]map[string]interface{}{networkPolicyAllowDNS: {"podSelector": map[string]interface{}{}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.np.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_NetworkPolicies_objects(t *testing.T) {
+	curContext = "test-ctx"
+	np := &NetworkPolicies{
+		Presets: []string{networkPolicyDenyIngress},
+		Custom: map[string]map[string]interface{}{
+			"allow-monitoring": {
+				"podSelector": map[string]interface{}{},
+				"ingress": []interface{}{map[string]interface{}{
+					"from": []interface{}{map[string]interface{}{"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"name": "monitoring"}}}},
+				}},
+			},
+		},
+	}
+	objects := np.objects("staging")
+	if len(objects) != 2 {
+		t.Fatalf("objects() returned %d objects, want 2", len(objects))
+	}
+	for i, want := range []string{"allow-monitoring", networkPolicyDenyIngress} {
+		d, err := yaml.Marshal(objects[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var obj struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name      string            `json:"name"`
+				Namespace string            `json:"namespace"`
+				Labels    map[string]string `json:"labels"`
+			} `json:"metadata"`
+			Spec map[string]interface{} `json:"spec"`
+		}
+		if err := yaml.Unmarshal(d, &obj); err != nil {
+			t.Fatal(err)
+		}
+		if obj.Kind != "NetworkPolicy" || obj.Metadata.Name != want || obj.Metadata.Namespace != "staging" {
+			t.Errorf("object %d = %s %s/%s, want NetworkPolicy staging/%s", i, obj.Kind, obj.Metadata.Namespace, obj.Metadata.Name, want)
+		}
+		if obj.Metadata.Labels["MANAGED-BY"] != "HELMSMAN" || obj.Metadata.Labels["HELMSMAN_CONTEXT"] != "test-ctx" {
+			t.Errorf("object %s labels = %v, want the Helmsman-owned labels", want, obj.Metadata.Labels)
+		}
+		if len(obj.Spec) == 0 {
+			t.Errorf("object %s has no spec", want)
+		}
+	}
+	if objects := (*NetworkPolicies)(nil).objects("staging"); len(objects) != 0 {
+		t.Errorf("objects() of nil policies = %v, want none", objects)
+	}
+}
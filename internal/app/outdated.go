@@ -0,0 +1,290 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Masterminds/semver"
+)
+
+const outdatedCommand = "outdated"
+
+// update levels, from the least to the most disruptive
+const (
+	updatePatch = "patch"
+	updateMinor = "minor"
+	updateMajor = "major"
+)
+
+var (
+	updateLevels         = []string{updatePatch, updateMinor, updateMajor}
+	yamlTopLevelKey      = regexp.MustCompile(`^[^\s#]`)
+	yamlVersionField     = regexp.MustCompile(`^(\s*version\s*:\s*)(["']?)([^"'\s#]+)(["']?)(.*)$`)
+	tomlVersionField     = regexp.MustCompile(`^(\s*version\s*=\s*)(["'])([^"']+)(["'])(.*)$`)
+	tomlSectionHeader    = regexp.MustCompile(`^\s*\[`)
+	outdatedReportFormat = []string{"table", "json"}
+)
+
+// chartUpdate is a newer version of the chart an app uses
+type chartUpdate struct {
+	App     string `json:"app"`
+	Chart   string `json:"chart"`
+	Current string `json:"current"`
+	Latest  string `json:"latest"`
+	Update  string `json:"update"`
+	// key is the name of the app in the desired state files
+	key string
+}
+
+// outdated finds the apps with newer versions of their charts available.
+// Only apps pinned to an exact version are checked, version constraints are left to resolve on their own.
+func (s *State) outdated() []chartUpdate {
+	var (
+		updates []chartUpdate
+		latest  = make(map[string]string)
+	)
+	apps := make([]string, 0, len(s.Apps))
+	for app := range s.Apps {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	for _, app := range apps {
+		r := s.Apps[app]
+		if !r.isConsideredToRun() || isLocalChart(r.Chart) {
+			continue
+		}
+		current, err := semver.NewVersion(r.Version)
+		if err != nil {
+			log.Verbose("App [ " + app + " ] uses the version constraint [ " + r.Version + " ], skipping it.")
+			continue
+		}
+		id := r.Chart + "@" + r.Version
+		if _, ok := latest[id]; !ok {
+			info, err := getChartInfo(r.Chart, ">= "+r.Version)
+			if err != nil {
+				log.Warning("Couldn't check the versions of chart [ " + r.Chart + " ]: " + err.Error())
+				continue
+			}
+			latest[id] = info.Version
+		}
+		found, err := semver.NewVersion(latest[id])
+		if err != nil {
+			continue
+		}
+		if kind := updateKind(current, found); kind != "" {
+			key := app
+			if r.origin != "" {
+				key = r.origin
+			}
+			updates = append(updates, chartUpdate{App: app, Chart: r.Chart, Current: r.Version, Latest: latest[id], Update: kind, key: key})
+		}
+	}
+	return updates
+}
+
+// updateKind classifies the update from one version to another as patch, minor or major
+func updateKind(from, to *semver.Version) string {
+	switch {
+	case !to.GreaterThan(from):
+		return ""
+	case to.Major() != from.Major():
+		return updateMajor
+	case to.Minor() != from.Minor():
+		return updateMinor
+	default:
+		return updatePatch
+	}
+}
+
+// updateConstraint returns the version constraint allowing updates of the given version up to the given level
+func updateConstraint(version *semver.Version, level string) string {
+	switch level {
+	case updatePatch:
+		return fmt.Sprintf(">= %s, < %d.%d.0", version, version.Major(), version.Minor()+1)
+	case updateMinor:
+		return fmt.Sprintf(">= %s, < %d.0.0", version, version.Major()+1)
+	default:
+		return ">= " + version.String()
+	}
+}
+
+// printOutdated writes the available chart updates as a table or as JSON
+func printOutdated(updates []chartUpdate, format string, out io.Writer) error {
+	if format == "json" {
+		if updates == nil {
+			updates = []chartUpdate{}
+		}
+		data, err := json.MarshalIndent(updates, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+	if len(updates) == 0 {
+		_, err := fmt.Fprintln(out, "All charts are up-to-date.")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "APP\tCHART\tCURRENT\tLATEST\tUPDATE")
+	for _, u := range updates {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", u.App, u.Chart, u.Current, u.Latest, u.Update)
+	}
+	return w.Flush()
+}
+
+// updateCharts rewrites the versions of the apps in the desired state files they are defined in,
+// taking the newest version that is at most a level away from the current one
+func (s *State) updateCharts(updates []chartUpdate, level string) error {
+	edits := make(map[string]map[string][2]string)
+	var files []string
+	for _, u := range updates {
+		current, _ := semver.NewVersion(u.Current)
+		target := u.Latest
+		if levelIndex(u.Update) > levelIndex(level) {
+			info, err := getChartInfo(u.Chart, updateConstraint(current, level))
+			if err != nil {
+				return err
+			}
+			target = info.Version
+		}
+		if target == u.Current {
+			continue
+		}
+		sources := s.appsSources[u.App]["version"]
+		if len(sources) != 1 {
+			log.Warning("The version of app [ " + u.App + " ] is not set by the app in a desired state file, skipping it.")
+			continue
+		}
+		file := sources[0]
+		if edits[file] == nil {
+			edits[file] = make(map[string][2]string)
+			files = append(files, file)
+		}
+		edits[file][u.key] = [2]string{u.Current, target}
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		lines := strings.Split(string(data), "\n")
+		for key, versions := range edits[file] {
+			if err := setAppVersion(lines, isOfType(file, []string{".toml", ".tml"}), key, versions[0], versions[1]); err != nil {
+				log.Warning(file + ": " + err.Error() + ", skipping it.")
+				continue
+			}
+			log.Info(fmt.Sprintf("Updated app [ %s ] from version [ %s ] to [ %s ] in %s", key, versions[0], versions[1], file))
+		}
+		if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func levelIndex(level string) int {
+	for i, l := range updateLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// setAppVersion replaces the version of an app in the lines of a YAML or TOML desired state file,
+// leaving everything else, including comments and formatting, untouched
+func setAppVersion(lines []string, isTOML bool, key, from, to string) error {
+	i := findAppVersion(lines, isTOML, key)
+	if i < 0 {
+		return fmt.Errorf("could not find the version of app [ %s ]", key)
+	}
+	field := yamlVersionField
+	if isTOML {
+		field = tomlVersionField
+	}
+	m := field.FindStringSubmatch(lines[i])
+	if m[3] != from {
+		return fmt.Errorf("app [ %s ] has version [ %s ] instead of [ %s ], it may be set with a variable", key, m[3], from)
+	}
+	lines[i] = m[1] + m[2] + to + m[4] + m[5]
+	return nil
+}
+
+// findAppVersion returns the index of the line setting the version of an app, or -1
+func findAppVersion(lines []string, isTOML bool, key string) int {
+	if isTOML {
+		return findTOMLAppVersion(lines, key)
+	}
+	return findYAMLAppVersion(lines, key)
+}
+
+func findTOMLAppVersion(lines []string, key string) int {
+	q := regexp.QuoteMeta(key)
+	header := regexp.MustCompile(`^\s*\[\s*apps\.(` + q + `|"` + q + `"|'` + q + `')\s*\]\s*(#.*)?$`)
+	inApp := false
+	for i, line := range lines {
+		switch {
+		case header.MatchString(line):
+			inApp = true
+		case tomlSectionHeader.MatchString(line):
+			inApp = false
+		case inApp && tomlVersionField.MatchString(line):
+			return i
+		}
+	}
+	return -1
+}
+
+func findYAMLAppVersion(lines []string, key string) int {
+	q := regexp.QuoteMeta(key)
+	appKey := regexp.MustCompile(`^\s*(` + q + `|"` + q + `"|'` + q + `')\s*:\s*(#.*)?$`)
+	var (
+		inApps      bool
+		inApp       bool
+		appIndent   = -1
+		fieldIndent = -1
+	)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if yamlTopLevelKey.MatchString(line) {
+			inApps = strings.HasPrefix(line, "apps:")
+			inApp = false
+			appIndent = -1
+			continue
+		}
+		if !inApps {
+			continue
+		}
+		if appIndent < 0 {
+			appIndent = indent
+		}
+		if indent <= appIndent {
+			inApp = indent == appIndent && appKey.MatchString(line)
+			fieldIndent = -1
+			continue
+		}
+		if !inApp {
+			continue
+		}
+		if fieldIndent < 0 {
+			fieldIndent = indent
+		}
+		if indent == fieldIndent && yamlVersionField.MatchString(line) {
+			return i
+		}
+	}
+	return -1
+}
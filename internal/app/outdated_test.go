@@ -0,0 +1,124 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver"
+)
+
+func Test_updateKind(t *testing.T) {
+	tests := []struct {
+		from, to, want string
+	}{
+		{"1.2.3", "1.2.3", ""},
+		{"1.2.3", "1.2.2", ""},
+		{"1.2.3", "1.2.4", updatePatch},
+		{"1.2.3", "1.3.0", updateMinor},
+		{"1.2.3", "2.0.0", updateMajor},
+	}
+	for _, tt := range tests {
+		if got := updateKind(semver.MustParse(tt.from), semver.MustParse(tt.to)); got != tt.want {
+			t.Errorf("updateKind(%s, %s) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func Test_updateConstraint(t *testing.T) {
+	v := semver.MustParse("1.2.3")
+	tests := map[string]string{
+		updatePatch: ">= 1.2.3, < 1.3.0",
+		updateMinor: ">= 1.2.3, < 2.0.0",
+		updateMajor: ">= 1.2.3",
+	}
+	for level, want := range tests {
+		if got := updateConstraint(v, level); got != want {
+			t.Errorf("updateConstraint(%s) = %s, want %s", level, got, want)
+		}
+	}
+}
+
+func Test_setAppVersion_yaml(t *testing.T) {
+	dsf := `settings:
+  version: "9.9.9"
+apps:
+  # the api
+  api:
+    chart: repo/api
+    version: "1.2.3" # pinned
+    hooks:
+      version: 1.2.3
+  "web":
+    enabled: true
+    chart: repo/web
+
+    version: 2.0.0
+namespaces:
+  web:
+    version: 2.0.0
+`
+	lines := strings.Split(dsf, "\n")
+	if err := setAppVersion(lines, false, "api", "1.2.3", "1.3.0"); err != nil {
+		t.Fatalf("setAppVersion() unexpected error: %v", err)
+	}
+	if err := setAppVersion(lines, false, "web", "2.0.0", "3.1.0"); err != nil {
+		t.Fatalf("setAppVersion() unexpected error: %v", err)
+	}
+	want := strings.Replace(strings.Replace(dsf, `version: "1.2.3" # pinned`, `version: "1.3.0" # pinned`, 1), "\n    version: 2.0.0", "\n    version: 3.1.0", 1)
+	if got := strings.Join(lines, "\n"); got != want {
+		t.Errorf("setAppVersion() =\n%s\nwant\n%s", got, want)
+	}
+
+	if err := setAppVersion(lines, false, "api", "1.2.3", "1.4.0"); err == nil {
+		t.Errorf("setAppVersion() expected an error when the current version doesn't match")
+	}
+	if err := setAppVersion(lines, false, "missing", "1.2.3", "1.4.0"); err == nil {
+		t.Errorf("setAppVersion() expected an error for a missing app")
+	}
+}
+
+func Test_setAppVersion_toml(t *testing.T) {
+	dsf := `[apps]
+
+  [apps.api]
+  chart = "repo/api"
+  version = "1.2.3" # pinned
+
+  [apps.web]
+  version = "2.0.0"
+`
+	lines := strings.Split(dsf, "\n")
+	if err := setAppVersion(lines, true, "web", "2.0.0", "2.0.1"); err != nil {
+		t.Fatalf("setAppVersion() unexpected error: %v", err)
+	}
+	want := strings.Replace(dsf, `version = "2.0.0"`, `version = "2.0.1"`, 1)
+	if got := strings.Join(lines, "\n"); got != want {
+		t.Errorf("setAppVersion() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_printOutdated(t *testing.T) {
+	updates := []chartUpdate{{App: "api", Chart: "repo/api", Current: "1.2.3", Latest: "2.0.0", Update: updateMajor}}
+
+	var table bytes.Buffer
+	if err := printOutdated(updates, "table", &table); err != nil {
+		t.Fatalf("printOutdated() unexpected error: %v", err)
+	}
+	if !strings.Contains(table.String(), "APP") || !strings.Contains(table.String(), "major") {
+		t.Errorf("printOutdated() table = %s", table.String())
+	}
+
+	var out bytes.Buffer
+	if err := printOutdated(updates, "json", &out); err != nil {
+		t.Fatalf("printOutdated() unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), `"update": "major"`) {
+		t.Errorf("printOutdated() json = %s", out.String())
+	}
+	out.Reset()
+	_ = printOutdated(nil, "json", &out)
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("printOutdated() json without updates = %s, want []", out.String())
+	}
+}
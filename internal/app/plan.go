@@ -131,6 +131,7 @@ func (p *plan) exec() {
 }
 
 func releaseWithHooks(cmd orderedCommand, storageBackend string, wg *sync.WaitGroup, sem chan struct{}, errors chan error) {
+	defer cleanupOnPanic()
 	defer func() {
 		wg.Done()
 		<-sem
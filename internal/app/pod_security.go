@@ -0,0 +1,216 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/pod-security-admission/api"
+	"k8s.io/pod-security-admission/policy"
+)
+
+// podSecurityLabelPrefix is the prefix of the Pod Security Admission labels of namespaces
+const podSecurityLabelPrefix = "pod-security.kubernetes.io/"
+
+// podSecurityLevels are the levels of the Pod Security Standards
+var podSecurityLevels = []string{"privileged", "baseline", "restricted"}
+
+// podSecurityVersion matches the versions of the Pod Security Standards: latest or a k8s minor version, e.g. v1.30
+var podSecurityVersion = regexp.MustCompile(`^(latest|v1\.[0-9]+)$`)
+
+// PodSecurity type represents the Pod Security Admission levels of a namespace
+type PodSecurity struct {
+	// Enforce is the level above which pods are rejected
+	Enforce string `json:"enforce,omitempty"`
+	// Audit is the level above which pods are recorded in the audit log
+	Audit string `json:"audit,omitempty"`
+	// Warn is the level above which users are warned when creating pods
+	Warn string `json:"warn,omitempty"`
+	// Version pins the Pod Security Standards to a k8s minor version, e.g. v1.30, defaults to latest
+	Version string `json:"version,omitempty"`
+}
+
+// modes returns the levels of the Pod Security Admission modes that are set, keyed by mode
+func (ps *PodSecurity) modes() map[string]string {
+	modes := make(map[string]string)
+	if ps == nil {
+		return modes
+	}
+	for mode, level := range map[string]string{"enforce": ps.Enforce, "audit": ps.Audit, "warn": ps.Warn} {
+		if level != "" {
+			modes[mode] = level
+		}
+	}
+	return modes
+}
+
+// validate validates the levels and the version
+func (ps *PodSecurity) validate() error {
+	if ps == nil {
+		return nil
+	}
+	modes := ps.modes()
+	if len(modes) == 0 {
+		return fmt.Errorf("at least one of enforce, audit or warn is needed")
+	}
+	for _, mode := range sortedKeys(modes) {
+		if !stringInSlice(modes[mode], podSecurityLevels) {
+			return fmt.Errorf("invalid %s level [ %s ], valid levels are: %s", mode, modes[mode], strings.Join(podSecurityLevels, ", "))
+		}
+	}
+	if ps.Version != "" && !podSecurityVersion.MatchString(ps.Version) {
+		return fmt.Errorf("invalid version [ %s ], it should be latest or a k8s minor version like v1.30", ps.Version)
+	}
+	return nil
+}
+
+// labels returns the Pod Security Admission labels of the namespace
+func (ps *PodSecurity) labels() map[string]string {
+	labels := make(map[string]string)
+	for mode, level := range ps.modes() {
+		labels[podSecurityLabelPrefix+mode] = level
+		if ps.Version != "" {
+			labels[podSecurityLabelPrefix+mode+"-version"] = ps.Version
+		}
+	}
+	return labels
+}
+
+// podTemplatePaths are the paths of the pod templates of the kinds that create pods, pods are checked as they are
+var podTemplatePaths = map[string][]string{
+	"Pod":                   nil,
+	"Deployment":            {"spec", "template"},
+	"ReplicaSet":            {"spec", "template"},
+	"StatefulSet":           {"spec", "template"},
+	"DaemonSet":             {"spec", "template"},
+	"Job":                   {"spec", "template"},
+	"ReplicationController": {"spec", "template"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template"},
+}
+
+// checkPodSecurity warns about the pods that the new Pod Security enforce levels of the namespaces would reject.
+// The running pods are checked with a server-side dry-run of the new labels, and the pods of the rendered manifests of the apps
+// that are going to be installed or upgraded are evaluated against the new enforce level and version.
+func (s *State) checkPodSecurity() {
+	for _, name := range sortedKeys(s.Namespaces) {
+		ns := s.Namespaces[name]
+		if ns.disabled || ns.PodSecurity == nil || ns.PodSecurity.Enforce == "" {
+			continue
+		}
+		levels := "the enforce level [ " + ns.PodSecurity.levelVersion() + " ] of namespace [ " + name + " ]"
+		_, _, exists, err := getNamespaceMetadata(name)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		if exists {
+			args := []string{"label", "--dry-run=server", "--overwrite", "namespace/" + name}
+			labels := ns.PodSecurity.labels()
+			for _, k := range sortedKeys(labels) {
+				if strings.HasPrefix(k, podSecurityLabelPrefix+"enforce") {
+					args = append(args, k+"="+labels[k])
+				}
+			}
+			cmd := kubectl(args, "Checking the running pods of namespace [ "+name+" ] against its new enforce level")
+			res, err := cmd.Exec()
+			logPodSecurityWarnings("Namespace [ "+name+" ]", levels, res, err)
+		}
+		for _, r := range s.Apps {
+			if r.Namespace != name || !r.isConsideredToRun() {
+				continue
+			}
+			subject := "Release [ " + r.Name + " ] in namespace [ " + name + " ]"
+			cmd := helmCmd(r.getHelmArgsFor("template"), "Rendering release [ "+r.Name+" ] in namespace [ "+name+" ] to check its pods against "+levels)
+			res, err := cmd.Exec()
+			if err != nil {
+				log.Warning(subject + " could not be checked against " + levels + ": " + err.Error())
+				continue
+			}
+			violations, err := ns.PodSecurity.violations([]byte(res.output))
+			if err != nil {
+				log.Warning(subject + " could not be checked against " + levels + ": " + err.Error())
+			} else if len(violations) > 0 {
+				log.Warning(subject + " has pods that would be rejected by " + levels + ":\n" + strings.Join(violations, "\n"))
+			}
+		}
+	}
+}
+
+// version returns the version of the Pod Security Standards, latest when it is not pinned
+func (ps *PodSecurity) version() string {
+	if ps.Version == "" {
+		return "latest"
+	}
+	return ps.Version
+}
+
+// levelVersion returns the enforce level and its version, as level:version
+func (ps *PodSecurity) levelVersion() string {
+	return ps.Enforce + ":" + ps.version()
+}
+
+// violations evaluates the pods of rendered manifests against the enforce level, and returns the objects
+// whose pods would be rejected with the reasons, as "Kind [ name ]: reasons"
+func (ps *PodSecurity) violations(manifests []byte) ([]string, error) {
+	level, err := api.ParseLevel(ps.Enforce)
+	if err != nil {
+		return nil, err
+	}
+	version, err := api.ParseVersion(ps.version())
+	if err != nil {
+		return nil, err
+	}
+	lv := api.LevelVersion{Level: level, Version: version}
+	evaluator, err := policy.NewEvaluator(policy.DefaultChecks())
+	if err != nil {
+		return nil, err
+	}
+	objects, err := decodeObjects(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the rendered manifests: %w", err)
+	}
+	var violations []string
+	for _, obj := range objects {
+		path, ok := podTemplatePaths[obj.kind()]
+		if !ok {
+			continue
+		}
+		template := map[string]interface{}(obj)
+		for _, k := range path {
+			template, _ = template[k].(map[string]interface{})
+		}
+		var pod struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+			Spec     corev1.PodSpec    `json:"spec"`
+		}
+		data, err := json.Marshal(template)
+		if err == nil {
+			err = json.Unmarshal(data, &pod)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the pods of %s [ %s ]: %w", obj.kind(), obj.name(), err)
+		}
+		result := policy.AggregateCheckResults(evaluator.EvaluatePod(lv, &pod.Metadata, &pod.Spec))
+		if !result.Allowed {
+			violations = append(violations, fmt.Sprintf("%s [ %s ]: %s", obj.kind(), obj.name(), result.ForbiddenDetail()))
+		}
+	}
+	return violations, nil
+}
+
+// logPodSecurityWarnings logs the Pod Security Admission warnings and rejections of a dry-run, levels describes the levels checked against
+func logPodSecurityWarnings(subject, levels string, res ExitStatus, err error) {
+	var violations []string
+	for _, line := range strings.Split(res.errors, "\n") {
+		if strings.Contains(line, "PodSecurity") {
+			violations = append(violations, strings.TrimSpace(line))
+		}
+	}
+	if len(violations) > 0 {
+		log.Warning(subject + " has pods that would be rejected by " + levels + ":\n" + strings.Join(violations, "\n"))
+	} else if err != nil {
+		log.Warning(subject + " could not be checked against " + levels + ": " + err.Error())
+	}
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_PodSecurity_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ps      *PodSecurity
+		wantErr bool
+	}{
+		{name: "nil", ps: nil},
+		{name: "enforce", ps: &PodSecurity{Enforce: "baseline"}},
+		{name: "all modes", ps: &PodSecurity{Enforce: "baseline", Audit: "restricted", Warn: "restricted", Version: "v1.30"}},
+		{name: "latest version", ps: &PodSecurity{Warn: "restricted", Version: "latest"}},
+		{name: "no mode", ps: &PodSecurity{Version: "latest"}, wantErr: true},
+		{name: "invalid level", ps: &PodSecurity{Enforce: "strict"}, wantErr: true},
+		{name: "invalid version", ps: &PodSecurity{Enforce: "baseline", Version: "1.30"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.ps.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_PodSecurity_labels(t *testing.T) {
+	ps := &PodSecurity{Enforce: "baseline", Warn: "restricted", Version: "v1.30"}
+	want := map[string]string{
+		"pod-security.kubernetes.io/enforce":         "baseline",
+		"pod-security.kubernetes.io/enforce-version": "v1.30",
+		"pod-security.kubernetes.io/warn":            "restricted",
+		"pod-security.kubernetes.io/warn-version":    "v1.30",
+	}
+	if got := ps.labels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("labels() = %v, want %v", got, want)
+	}
+	if got := (*PodSecurity)(nil).labels(); len(got) != 0 {
+		t.Errorf("labels() of nil = %v, want none", got)
+	}
+}
+
+func Test_State_namespaceLabels_podSecurity(t *testing.T) {
+	s := &State{}
+	ns := &Namespace{Labels: map[string]string{"team": "a"}, PodSecurity: &PodSecurity{Enforce: "restricted"}}
+	want := map[string]string{"team": "a", "pod-security.kubernetes.io/enforce": "restricted"}
+	if got := s.namespaceLabels(ns); !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaceLabels() = %v, want %v", got, want)
+	}
+	if len(ns.Labels) != 1 {
+		t.Errorf("namespaceLabels() changed the labels of the namespace: %v", ns.Labels)
+	}
+}
+
+func Test_Namespace_validate_podSecurityLabels(t *testing.T) {
+	ns := &Namespace{
+		Labels:      map[string]string{"pod-security.kubernetes.io/enforce": "baseline"},
+		PodSecurity: &PodSecurity{Enforce: "restricted"},
+	}
+	if err := ns.validate(); err == nil {
+		t.Errorf("validate() error = nil, want an error for the pod security label defined in labels")
+	}
+	ns.Labels = map[string]string{"team": "a"}
+	if err := ns.validate(); err != nil {
+		t.Errorf("validate() unexpected error: %v", err)
+	}
+}
+
+func Test_PodSecurity_violations(t *testing.T) {
+	manifests := []byte(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx
+          securityContext:
+            privileged: true
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          hostNetwork: true
+          containers:
+            - name: backup
+              image: busybox
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: sidecar
+spec:
+  securityContext:
+    runAsNonRoot: true
+    seccompProfile:
+      type: RuntimeDefault
+  containers:
+    - name: sidecar
+      image: busybox
+      securityContext:
+        allowPrivilegeEscalation: false
+        capabilities:
+          drop: [ALL]
+`)
+	got, err := (&PodSecurity{Enforce: "baseline"}).violations(manifests)
+	if err != nil {
+		t.Fatalf("violations() unexpected error: %v", err)
+	}
+	want := []string{"Deployment [ web ]: privileged (container \"web\" must not set securityContext.privileged=true)", "CronJob [ backup ]: host namespaces (hostNetwork=true)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("violations() = %q, want %q", got, want)
+	}
+
+	got, err = (&PodSecurity{Enforce: "restricted", Version: "v1.30"}).violations(manifests)
+	if err != nil {
+		t.Fatalf("violations() unexpected error: %v", err)
+	}
+	if len(got) != 2 || !strings.HasPrefix(got[0], "Deployment [ web ]: ") || !strings.HasPrefix(got[1], "CronJob [ backup ]: ") {
+		t.Errorf("violations() at the restricted level = %q, want the web Deployment and backup CronJob only", got)
+	}
+
+	if got, err := (&PodSecurity{Enforce: "privileged"}).violations(manifests); err != nil || len(got) != 0 {
+		t.Errorf("violations() at the privileged level = %q, %v, want none", got, err)
+	}
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const rbacAPIVersion = "rbac.authorization.k8s.io/v1"
+
+// RBAC type represents the roles and role bindings Helmsman manages in a namespace
+type RBAC struct {
+	// Roles are inline Roles, keyed by name, that bindings can refer to
+	Roles map[string][]PolicyRule `json:"roles,omitempty"`
+	// Bindings are RoleBindings, keyed by name
+	Bindings map[string]*RoleBinding `json:"bindings,omitempty"`
+}
+
+// PolicyRule is a rule of a Role
+type PolicyRule struct {
+	// APIGroups are the API groups of the resources, "" is the core API group
+	APIGroups []string `json:"apiGroups"`
+	// Resources the rule applies to
+	Resources []string `json:"resources"`
+	// ResourceNames optionally restricts the rule to some objects
+	ResourceNames []string `json:"resourceNames,omitempty"`
+	// Verbs allowed on the resources
+	Verbs []string `json:"verbs"`
+}
+
+// RoleBinding binds groups, users and service accounts to a ClusterRole or to one of the inline Roles
+type RoleBinding struct {
+	// ClusterRole is the name of the ClusterRole to bind, e.g. edit
+	ClusterRole string `json:"clusterRole,omitempty"`
+	// Role is the name of an inline Role to bind
+	Role string `json:"role,omitempty"`
+	// Groups to bind the role to
+	Groups []string `json:"groups,omitempty"`
+	// Users to bind the role to
+	Users []string `json:"users,omitempty"`
+	// ServiceAccounts to bind the role to, as name for the service accounts of the namespace or namespace/name
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+}
+
+// validate validates the roles and the bindings
+func (rb *RBAC) validate() error {
+	if rb == nil {
+		return nil
+	}
+	for name, rules := range rb.Roles {
+		if !dns1123Name.MatchString(name) {
+			return fmt.Errorf("role name [ %s ] is not a valid k8s object name", name)
+		}
+		if len(rules) == 0 {
+			return fmt.Errorf("role [ %s ] has no rules", name)
+		}
+		for _, rule := range rules {
+			if len(rule.Resources) == 0 || len(rule.Verbs) == 0 {
+				return fmt.Errorf("the rules of role [ %s ] need resources and verbs", name)
+			}
+		}
+	}
+	for name, b := range rb.Bindings {
+		if !dns1123Name.MatchString(name) {
+			return fmt.Errorf("binding name [ %s ] is not a valid k8s object name", name)
+		}
+		if b == nil {
+			return fmt.Errorf("binding [ %s ] is empty", name)
+		}
+		if (b.ClusterRole == "") == (b.Role == "") {
+			return fmt.Errorf("binding [ %s ] needs either a clusterRole or a role", name)
+		}
+		if _, ok := rb.Roles[b.Role]; b.Role != "" && !ok {
+			return fmt.Errorf("binding [ %s ] refers to role [ %s ], which is not defined in roles", name, b.Role)
+		}
+		if len(b.Groups)+len(b.Users)+len(b.ServiceAccounts) == 0 {
+			return fmt.Errorf("binding [ %s ] needs at least one group, user or service account", name)
+		}
+		for _, sa := range b.ServiceAccounts {
+			if _, _, err := splitServiceAccount(sa, "namespace"); err != nil {
+				return fmt.Errorf("binding [ %s ]: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// objects returns the desired Roles and RoleBindings of a namespace
+func (rb *RBAC) objects(ns string) ([]namespaceObject, []namespaceObject) {
+	var roles, bindings []namespaceObject
+	if rb == nil {
+		return roles, bindings
+	}
+	for _, name := range sortedKeys(rb.Roles) {
+		roles = append(roles, newNamespaceObject(rbacAPIVersion, "Role", ns, name, map[string]interface{}{
+			"rules": rb.Roles[name],
+		}))
+	}
+	for _, name := range sortedKeys(rb.Bindings) {
+		bindings = append(bindings, newNamespaceObject(rbacAPIVersion, "RoleBinding", ns, name, rb.Bindings[name].fields(ns)))
+	}
+	return roles, bindings
+}
+
+// fields returns the roleRef and subjects of a RoleBinding object
+func (b *RoleBinding) fields(ns string) map[string]interface{} {
+	roleRef := map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": "ClusterRole", "name": b.ClusterRole}
+	if b.Role != "" {
+		roleRef["kind"], roleRef["name"] = "Role", b.Role
+	}
+	var subjects []interface{}
+	for _, g := range b.Groups {
+		subjects = append(subjects, map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": "Group", "name": g})
+	}
+	for _, u := range b.Users {
+		subjects = append(subjects, map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": "User", "name": u})
+	}
+	for _, sa := range b.ServiceAccounts {
+		saNs, name, _ := splitServiceAccount(sa, ns)
+		subjects = append(subjects, map[string]interface{}{"kind": "ServiceAccount", "name": name, "namespace": saNs})
+	}
+	return map[string]interface{}{"roleRef": roleRef, "subjects": subjects}
+}
+
+// splitServiceAccount splits a namespace/name service account reference, ns is the namespace of a plain name
+func splitServiceAccount(sa, ns string) (string, string, error) {
+	name := sa
+	if i := strings.Index(sa, "/"); i >= 0 {
+		ns, name = sa[:i], sa[i+1:]
+	}
+	if name == "" || ns == "" || strings.Contains(name, "/") {
+		return "", "", errors.New("service account [ " + sa + " ] should be a name or namespace/name")
+	}
+	return ns, name, nil
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_RBAC_validate(t *testing.T) {
+	roles := map[string][]PolicyRule{"deployer": {{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "patch"}}}}
+	tests := []struct {
+		name    string
+		rbac    *RBAC
+		wantErr bool
+	}{
+		{name: "nil", rbac: nil},
+		{name: "cluster role binding", rbac: &RBAC{Bindings: map[string]*RoleBinding{"team-a-edit": {ClusterRole: "edit", Groups: []string{"team-a"}}}}},
+		{name: "inline role binding", rbac: &RBAC{Roles: roles, Bindings: map[string]*RoleBinding{"ci": {Role: "deployer", ServiceAccounts: []string{"ci", "tools/ci"}}}}},
+		{name: "undefined role", rbac: &RBAC{Bindings: map[string]*RoleBinding{"ci": {Role: "deployer", Users: []string{"ci"}}}}, wantErr: true},
+		{name: "both roles", rbac: &RBAC{Roles: roles, Bindings: map[string]*RoleBinding{"ci": {Role: "deployer", ClusterRole: "edit", Users: []string{"ci"}}}}, wantErr: true},
+		{name: "no subjects", rbac: &RBAC{Bindings: map[string]*RoleBinding{"ci": {ClusterRole: "edit"}}}, wantErr: true},
+		{name: "invalid service account", rbac: &RBAC{Bindings: map[string]*RoleBinding{"ci": {ClusterRole: "edit", ServiceAccounts: []string{"tools/"}}}}, wantErr: true},
+		{name: "role without verbs", rbac: &RBAC{Roles: map[string][]PolicyRule{"reader": {{Resources: []string{"pods"}}}}}, wantErr: true},
+		{name: "invalid binding name", rbac: &RBAC{Bindings: map[string]*RoleBinding{"Team_A": {ClusterRole: "view", Groups: []string{"team-a"}}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rbac.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_RBAC_objects(t *testing.T) {
+	curContext = "test-ctx"
+	rbac := &RBAC{
+		Roles: map[string][]PolicyRule{"deployer": {{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}}}},
+		Bindings: map[string]*RoleBinding{
+			"ci": {Role: "deployer", Groups: []string{"team-a"}, ServiceAccounts: []string{"ci", "tools/runner"}},
+		},
+	}
+	roles, bindings := rbac.objects("staging")
+	if len(roles) != 1 || roles[0].kind() != "Role" || roles[0].name() != "deployer" {
+		t.Fatalf("objects() roles = %v, want the deployer Role", roles)
+	}
+	if len(bindings) != 1 || bindings[0].kind() != "RoleBinding" || bindings[0].name() != "ci" {
+		t.Fatalf("objects() bindings = %v, want the ci RoleBinding", bindings)
+	}
+	wantRoleRef := map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": "Role", "name": "deployer"}
+	if !reflect.DeepEqual(bindings[0]["roleRef"], wantRoleRef) {
+		t.Errorf("objects() roleRef = %v, want %v", bindings[0]["roleRef"], wantRoleRef)
+	}
+	wantSubjects := []interface{}{
+		map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": "Group", "name": "team-a"},
+		map[string]interface{}{"kind": "ServiceAccount", "name": "ci", "namespace": "staging"},
+		map[string]interface{}{"kind": "ServiceAccount", "name": "runner", "namespace": "tools"},
+	}
+	if !reflect.DeepEqual(bindings[0]["subjects"], wantSubjects) {
+		t.Errorf("objects() subjects = %v, want %v", bindings[0]["subjects"], wantSubjects)
+	}
+}
+
+func Test_planNamespaceObjectChanges_roleRef(t *testing.T) {
+	if err := os.MkdirAll(tempFilesDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempFilesDir)
+	curContext = "test-ctx"
+	_, current := (&RBAC{Bindings: map[string]*RoleBinding{
+		"edit": {ClusterRole: "view", Groups: []string{"team-a"}},
+		"ci":   {ClusterRole: "edit", Groups: []string{"team-a"}},
+	}}).objects("staging")
+	existing := make(map[string]namespaceObject)
+	for _, obj := range current {
+		n, err := obj.normalized()
+		if err != nil {
+			t.Fatal(err)
+		}
+		existing[obj.name()] = n
+	}
+	_, desired := (&RBAC{Bindings: map[string]*RoleBinding{
+		"edit": {ClusterRole: "edit", Groups: []string{"team-a"}},
+		"ci":   {ClusterRole: "edit", Groups: []string{"team-a", "team-b"}},
+	}}).objects("staging")
+
+	p := createPlan()
+	if err := planNamespaceObjectChanges(p, "staging", "rolebinding", desired, existing, 0); err != nil {
+		t.Fatalf("planNamespaceObjectChanges() unexpected error: %v", err)
+	}
+	var verbs []string
+	for _, cmd := range p.Commands {
+		verbs = append(verbs, cmd.Command.Args[0]+": "+cmd.Command.Description)
+	}
+	want := []string{
+		"apply: Applying RoleBinding [ ci ] in namespace [ staging ]",
+		"replace: Recreating RoleBinding [ edit ] in namespace [ staging ]",
+	}
+	if !reflect.DeepEqual(verbs, want) {
+		t.Errorf("planNamespaceObjectChanges() commands = %v, want %v", verbs, want)
+	}
+	if args := p.Commands[1].Command.Args; !reflect.DeepEqual(args[:3], []string{"replace", "--force", "--save-config"}) {
+		t.Errorf("planNamespaceObjectChanges() recreated the binding with %v, want a forced replace", args)
+	}
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// redactedValue replaces the secret values in the output
+	redactedValue = "******"
+	// minRedactedLength is the length under which values are not redacted, to not mask every "true" or "1" in the output
+	minRedactedLength = 4
+)
+
+// redactor knows the secret values resolved during the run and scrubs them from any text leaving the process
+type redactor struct {
+	values   map[string]struct{}
+	replacer *strings.Replacer
+	mutex    sync.RWMutex
+}
+
+// redactions scrubs the logs, plan output, notifications and errors
+var redactions = &redactor{values: make(map[string]struct{})}
+
+// add registers secret values, together with their escaped form in --set arguments and each line of multi-line values
+func (r *redactor) add(values ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	changed := false
+	for _, v := range values {
+		variants := []string{v, strings.ReplaceAll(v, ",", "\\,")}
+		if strings.Contains(v, "\n") {
+			for _, line := range strings.Split(v, "\n") {
+				variants = append(variants, strings.TrimSpace(line))
+			}
+		}
+		for _, variant := range variants {
+			if len(variant) < minRedactedLength {
+				continue
+			}
+			if _, ok := r.values[variant]; !ok {
+				r.values[variant] = struct{}{}
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+	// longer values go first, so a value containing another one is redacted as a whole
+	sorted := make([]string, 0, len(r.values))
+	for v := range r.values {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, v := range sorted {
+		pairs = append(pairs, v, redactedValue)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// addYAML registers the string values of a YAML document, e.g. a decrypted secrets file
+func (r *redactor) addYAML(content string) {
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		// not YAML, the whole content is a secret
+		r.add(content)
+		return
+	}
+	var values []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for _, e := range t {
+				walk(e)
+			}
+		case []interface{}:
+			for _, e := range t {
+				walk(e)
+			}
+		case string:
+			values = append(values, t)
+		}
+	}
+	walk(doc)
+	r.add(values...)
+}
+
+// redact replaces the registered secret values in a string
+func (r *redactor) redact(s string) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// reset forgets all the registered values
+func (r *redactor) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.values = make(map[string]struct{})
+	r.replacer = nil
+}
+
+// redactingWriter scrubs the registered secret values from everything written to it
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, redactions.redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// sensitiveValues returns the values of the desired state that are secrets:
+// the values of the env variables listed in settings.sensitiveEnvVars, the cluster password,
+// the credentials of the namespaces image pull secrets and the set and setString entries listed in the sensitiveKeys of the apps
+func (s *State) sensitiveValues() []string {
+	var values []string
+	for _, name := range s.Settings.SensitiveEnvVars {
+		if v, ok := os.LookupEnv(name); ok {
+			values = append(values, v)
+		}
+	}
+	if s.Settings.Password != "" {
+		values = append(values, s.Settings.Password)
+	}
+	for _, ns := range s.Namespaces {
+		if ns == nil {
+			continue
+		}
+		for _, ips := range ns.ImagePullSecrets {
+			if ips != nil {
+				values = append(values, ips.Password, ips.DockerConfigJSON)
+			}
+		}
+	}
+	for _, r := range s.Apps {
+		for _, key := range r.SensitiveKeys {
+			if v, ok := r.Set[key]; ok {
+				values = append(values, v)
+			}
+			if v, ok := r.SetString[key]; ok {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_redactor_redact(t *testing.T) {
+	r := &redactor{values: make(map[string]struct{})}
+	if got := r.redact("nothing registered"); got != "nothing registered" {
+		t.Errorf("redact() = %q without registered values", got)
+	}
+	r.add("s3cr3t", "s3cr3t-longer", "a,b,c,d", "yes", "-----BEGIN KEY-----\nAAAABBBB\n-----END KEY-----")
+
+	tests := map[string]string{
+		"--set db.password=s3cr3t":            "--set db.password=******",
+		"token: s3cr3t-longer":                "token: ******",
+		"--set list=a\\,b\\,c\\,d":            "--set list=******",
+		"enabled: yes":                        "enabled: yes",
+		"line of the key: AAAABBBB, redacted": "line of the key: ******, redacted",
+	}
+	for in, want := range tests {
+		if got := r.redact(in); got != want {
+			t.Errorf("redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func Test_redactor_addYAML(t *testing.T) {
+	r := &redactor{values: make(map[string]struct{})}
+	r.addYAML("secret:\n  password: s3cr3t\n  port: 5432\n  tokens: [abcd1234]\n")
+	var got []string
+	for v := range r.values {
+		got = append(got, v)
+	}
+	sort.Strings(got)
+	if want := []string{"abcd1234", "s3cr3t"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("addYAML() registered %v, want %v", got, want)
+	}
+}
+
+func Test_redactingWriter(t *testing.T) {
+	defer redactions.reset()
+	redactions.add("hunter22")
+	var buf bytes.Buffer
+	w := redactingWriter{out: &buf}
+	msg := "helm upgrade --set password=hunter22"
+	if n, err := w.Write([]byte(msg)); err != nil || n != len(msg) {
+		t.Errorf("Write() = %d, %v, want %d, nil", n, err, len(msg))
+	}
+	if got := buf.String(); got != "helm upgrade --set password=******" {
+		t.Errorf("Write() wrote %q", got)
+	}
+	cmd := Command{Cmd: "helm", Args: []string{"upgrade", "--set-string", "token=hunter22"}}
+	if got := cmd.String(); got != "helm upgrade --set-string token=******" {
+		t.Errorf("Command.String() = %q, want the secret redacted", got)
+	}
+}
+
+func Test_State_sensitiveValues(t *testing.T) {
+	os.Setenv("HELMSMAN_TEST_SENSITIVE", "env-secret")
+	defer os.Unsetenv("HELMSMAN_TEST_SENSITIVE")
+	s := State{
+		Settings: Config{SensitiveEnvVars: []string{"HELMSMAN_TEST_SENSITIVE", "HELMSMAN_TEST_UNSET"}},
+		Apps: map[string]*Release{
+			"app": {
+				Set:           map[string]string{"db.password": "set-secret", "replicas": "3"},
+				SetString:     map[string]string{"token": "string-secret", "image": "nginx"},
+				SensitiveKeys: []string{"db.password", "token"},
+			},
+		},
+	}
+	got := s.sensitiveValues()
+	sort.Strings(got)
+	if want := []string{"env-secret", "set-secret", "string-secret"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sensitiveValues() = %v, want %v", got, want)
+	}
+}
@@ -16,16 +16,24 @@ type Release struct {
 	Description string `json:"description,omitempty"`
 	// Namespace where to deploy the helm release
 	Namespace string `json:"namespace"`
+	// Namespaces deploys one helm release per namespace in the list, it can't be used with Namespace
+	Namespaces []string `json:"namespaces,omitempty"`
 	// Enabled can be used to togle a helm release
 	Enabled NullBool `json:"enabled"`
 	Group   string   `json:"group,omitempty"`
-	Chart   string   `json:"chart"`
+	// Labels are arbitrary key/value pairs used to select apps with --selector
+	Labels map[string]string `json:"labels,omitempty"`
+	// Template is the name, or list of names, of appsTemplates the release inherits from
+	Template StringList `json:"template,omitempty"`
+	Chart    string     `json:"chart"`
 	// Version of the helm chart to deploy
 	Version string `json:"version"`
 	// ValuesFile is the path for a values file for the helm release
 	ValuesFile string `json:"valuesFile,omitempty"`
 	// ValuesFiles is a list of paths a values files for the helm release
 	ValuesFiles []string `json:"valuesFiles,omitempty"`
+	// Values are inline values for the helm release, they take priority over the values files
+	Values map[string]interface{} `json:"values,omitempty"`
 	// SecretsFile is the path for an encrypted values file for the helm release
 	SecretsFile string `json:"secretsFile,omitempty"`
 	// SecretsFiles is a list of paths for encrypted values files for the helm release
@@ -46,6 +54,8 @@ type Release struct {
 	SetString map[string]string `json:"setString,omitempty"`
 	// SetFile can be used to overwrite the chart values
 	SetFile map[string]string `json:"setFile,omitempty"`
+	// SensitiveKeys lists the keys of Set and SetString holding secrets, their values are redacted from the output
+	SensitiveKeys []string `json:"sensitiveKeys,omitempty"`
 	// HelmFlags is a list of additional flags to pass to the helm command
 	HelmFlags []string `json:"helmFlags,omitempty"`
 	// HelmDiffFlags is a list of cli flags to pass to helm diff
@@ -57,8 +67,11 @@ type Release struct {
 	// Hooks can be used to define lifecycle hooks specific to this release
 	Hooks map[string]interface{} `json:"hooks,omitempty"`
 	// MaxHistory is the maximum number of histoical releases to keep
-	MaxHistory int `json:"maxHistory,omitempty"`
-	disabled   bool
+	MaxHistory       int `json:"maxHistory,omitempty"`
+	disabled         bool
+	inlineValuesFile string
+	// origin is the key of the app this release was generated from when deployed to multiple namespaces
+	origin string
 }
 
 func (r *Release) key() string {
@@ -333,7 +346,7 @@ func (r *Release) isProtected(cs *currentState, n *Namespace) bool {
 	if ok := cs.releaseExists(r, ""); !ok {
 		return false
 	}
-	if n.Protected || r.Protected.Value {
+	if n.Protected.Value || r.Protected.Value {
 		return true
 	}
 	return false
@@ -623,6 +636,8 @@ func (r Release) print() {
 	fmt.Println("\tpostDelete: ", r.Hooks[postDelete])
 	fmt.Println("\tno-hooks: ", r.NoHooks.Value)
 	fmt.Println("\ttimeout: ", r.Timeout)
+	fmt.Println("\thelmFlags: ", strings.Join(r.HelmFlags, " "))
+	fmt.Println("\tmaxHistory: ", r.MaxHistory)
 	fmt.Println("\tvalues to override from env:")
 	printMap(r.Set, 2)
 	fmt.Println("------------------- ")
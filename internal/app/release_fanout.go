@@ -0,0 +1,92 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// namespacePlaceholder is replaced with the namespace of each release generated from an app deployed to multiple namespaces
+const namespacePlaceholder = "{{namespace}}"
+
+// expandNamespaces replaces every app deployed to multiple namespaces with one app per namespace.
+// The generated apps are keyed <app>-<namespace> and their release name is the app name with
+// {{namespace}} substituted, or <name>-<namespace> when the name doesn't use the placeholder.
+func (s *State) expandNamespaces() error {
+	keys := make([]string, 0, len(s.Apps))
+	for key, r := range s.Apps {
+		if r != nil && len(r.Namespaces) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	downloadDest, _ := filepath.Abs(createTempDir(tempFilesDir, "tmp"))
+
+	for _, key := range keys {
+		r := s.Apps[key]
+		if r.Namespace != "" {
+			return fmt.Errorf("app [ %s ]: namespace and namespaces should not be used together", key)
+		}
+		delete(s.Apps, key)
+
+		name := r.Name
+		if name == "" {
+			name = key
+		}
+		seen := make(map[string]bool)
+		for _, ns := range r.Namespaces {
+			if seen[ns] {
+				return fmt.Errorf("app [ %s ]: namespace [ %s ] is listed more than once", key, ns)
+			}
+			seen[ns] = true
+
+			generatedKey := key + "-" + ns
+			if _, ok := s.Apps[generatedKey]; ok {
+				return fmt.Errorf("app [ %s ]: the app generated for namespace [ %s ] conflicts with the existing app [ %s ]", key, ns, generatedKey)
+			}
+			generated := r.clone()
+			generated.Namespaces = nil
+			generated.Namespace = ns
+			generated.origin = key
+			if strings.Contains(name, namespacePlaceholder) {
+				generated.Name = strings.ReplaceAll(name, namespacePlaceholder, ns)
+			} else {
+				generated.Name = name + "-" + ns
+			}
+			generated.expandNamespaceFiles(ns, downloadDest)
+			s.Apps[generatedKey] = generated
+
+			if sources, ok := s.appsSources[key]; ok {
+				s.appsSources[generatedKey] = sources
+			}
+		}
+		if s.appsSources != nil {
+			delete(s.appsSources, key)
+		}
+	}
+	return nil
+}
+
+// expandNamespaceFiles substitutes the namespace into the release values and secrets file patterns,
+// then resolves and expands the resulting files like any other release file
+func (r *Release) expandNamespaceFiles(ns, downloadDest string) {
+	expand := func(file string) string {
+		if !isNamespacePattern(file) {
+			return file
+		}
+		file, _ = resolveOnePath(strings.ReplaceAll(file, namespacePlaceholder, ns), "", downloadDest)
+		return substituteVarsInYaml(file)
+	}
+	r.ValuesFile = expand(r.ValuesFile)
+	r.SecretsFile = expand(r.SecretsFile)
+	for i := range r.ValuesFiles {
+		r.ValuesFiles[i] = expand(r.ValuesFiles[i])
+	}
+	for i := range r.SecretsFiles {
+		r.SecretsFiles[i] = expand(r.SecretsFiles[i])
+	}
+}
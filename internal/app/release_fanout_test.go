@@ -0,0 +1,111 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_build_expandsNamespaces(t *testing.T) {
+	teardownTestCase, err := setupStateFileTestCase(t)
+	if err != nil {
+		t.Errorf("setupStateFileTestCase(), got: %v", err)
+	}
+	defer teardownTestCase(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"dsf.yaml": `helmRepos:
+  repo: https://example.com/charts
+namespaces:
+  tenant-a:
+  tenant-b:
+apps:
+  agent:
+    namespaces: [tenant-a, tenant-b]
+    chart: repo/agent
+    version: 1.0.0
+    valuesFiles:
+      - values.yaml
+      - values-{{namespace}}.yaml
+  exporter:
+    name: "exporter-{{namespace}}-v1"
+    namespaces: [tenant-a]
+    chart: repo/exporter
+    version: 1.0.0
+`,
+		"values.yaml":          "common: true\n",
+		"values-tenant-a.yaml": "tenant: a\n",
+		"values-tenant-b.yaml": "tenant: b\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := new(State)
+	if err := s.build(fileOptionArray{{name: filepath.Join(dir, "dsf.yaml")}}); err != nil {
+		t.Fatalf("build() - unexpected error: %v", err)
+	}
+	if _, ok := s.Apps["agent"]; ok || len(s.Apps) != 3 {
+		t.Fatalf("build() - wanted the agent app to be replaced by one app per namespace, got %v", s.Apps)
+	}
+	for _, ns := range []string{"tenant-a", "tenant-b"} {
+		r := s.Apps["agent-"+ns]
+		if r == nil {
+			t.Fatalf("build() - app agent-%s was not generated", ns)
+		}
+		if r.Name != "agent-"+ns || r.Namespace != ns || len(r.Namespaces) != 0 {
+			t.Errorf("build() - unexpected generated release name [ %s ] namespace [ %s ]", r.Name, r.Namespace)
+		}
+		if len(r.ValuesFiles) != 2 {
+			t.Fatalf("build() - unexpected values files %v", r.ValuesFiles)
+		}
+		data, err := os.ReadFile(r.ValuesFiles[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "tenant: "+strings.TrimPrefix(ns, "tenant-")) {
+			t.Errorf("build() - values file pattern for [ %s ] resolved to the wrong file: %s", ns, string(data))
+		}
+	}
+	if r := s.Apps["exporter-tenant-a"]; r == nil || r.Name != "exporter-tenant-a-v1" {
+		t.Errorf("build() - wanted the namespace placeholder to be substituted in the release name, got %+v", r)
+	}
+}
+
+func Test_state_expandNamespaces_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		apps    map[string]*Release
+		wantErr string
+	}{
+		{
+			name:    "namespace and namespaces",
+			apps:    map[string]*Release{"app": {Namespace: "a", Namespaces: []string{"b"}}},
+			wantErr: "namespace and namespaces should not be used together",
+		}, {
+			name: "conflicting app",
+			apps: map[string]*Release{
+				"app":   {Namespaces: []string{"a"}},
+				"app-a": {Namespace: "a"},
+			},
+			wantErr: "conflicts with the existing app [ app-a ]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			teardownTestCase, err := setupStateFileTestCase(t)
+			if err != nil {
+				t.Errorf("setupStateFileTestCase(), got: %v", err)
+			}
+			defer teardownTestCase(t)
+			s := &State{Apps: tt.apps}
+			if err := s.expandNamespaces(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expandNamespaces() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
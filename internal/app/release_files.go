@@ -1,23 +1,29 @@
 package app
 
 import (
+	"path/filepath"
 	"strings"
 )
 
 // substituteVarsInStaticFiles loops through the values/secrets files and substitutes variables into them.
+// File patterns using the namespace placeholder are substituted once the app is expanded per namespace.
 func (r *Release) substituteVarsInStaticFiles() {
-	if r.ValuesFile != "" {
+	if r.ValuesFile != "" && !isNamespacePattern(r.ValuesFile) {
 		r.ValuesFile = substituteVarsInYaml(r.ValuesFile)
 	}
-	if r.SecretsFile != "" {
+	if r.SecretsFile != "" && !isNamespacePattern(r.SecretsFile) {
 		r.SecretsFile = substituteVarsInYaml(r.SecretsFile)
 	}
 
 	for i := range r.ValuesFiles {
-		r.ValuesFiles[i] = substituteVarsInYaml(r.ValuesFiles[i])
+		if !isNamespacePattern(r.ValuesFiles[i]) {
+			r.ValuesFiles[i] = substituteVarsInYaml(r.ValuesFiles[i])
+		}
 	}
 	for i := range r.SecretsFiles {
-		r.SecretsFiles[i] = substituteVarsInYaml(r.SecretsFiles[i])
+		if !isNamespacePattern(r.SecretsFiles[i]) {
+			r.SecretsFiles[i] = substituteVarsInYaml(r.SecretsFiles[i])
+		}
 	}
 
 	for key, val := range r.Hooks {
@@ -33,17 +39,17 @@ func (r *Release) substituteVarsInStaticFiles() {
 // resolvePaths resolves relative paths of certs/keys/chart/value file/secret files/etc and replace them with a absolute paths
 func (r *Release) resolvePaths(dir, downloadDest string) {
 	if r.ValuesFile != "" {
-		r.ValuesFile, _ = resolveOnePath(r.ValuesFile, dir, downloadDest)
+		r.ValuesFile = resolveReleasePath(r.ValuesFile, dir, downloadDest)
 	}
 	if r.SecretsFile != "" {
-		r.SecretsFile, _ = resolveOnePath(r.SecretsFile, dir, downloadDest)
+		r.SecretsFile = resolveReleasePath(r.SecretsFile, dir, downloadDest)
 	}
 
 	for i, file := range r.ValuesFiles {
-		r.ValuesFiles[i], _ = resolveOnePath(file, dir, downloadDest)
+		r.ValuesFiles[i] = resolveReleasePath(file, dir, downloadDest)
 	}
 	for i, file := range r.SecretsFiles {
-		r.SecretsFiles[i], _ = resolveOnePath(file, dir, downloadDest)
+		r.SecretsFiles[i] = resolveReleasePath(file, dir, downloadDest)
 	}
 
 	for key, val := range r.Hooks {
@@ -57,6 +63,32 @@ func (r *Release) resolvePaths(dir, downloadDest string) {
 	}
 }
 
+// resolveReleasePath resolves a release file path.
+// Local file patterns using the namespace placeholder are only made absolute, they are resolved once the app is expanded per namespace.
+func resolveReleasePath(file, dir, downloadDest string) string {
+	if !isNamespacePattern(file) {
+		file, _ = resolveOnePath(file, dir, downloadDest)
+		return file
+	}
+	if !strings.Contains(file, "://") && !filepath.IsAbs(file) {
+		file, _ = filepath.Abs(filepath.Join(dir, file))
+	}
+	return file
+}
+
+// isNamespacePattern checks if a file path uses the namespace placeholder
+func isNamespacePattern(file string) bool {
+	return strings.Contains(file, namespacePlaceholder)
+}
+
+// getSecretsFiles returns the secrets files of the release, secretsFile takes priority over secretsFiles
+func (r *Release) getSecretsFiles() []string {
+	if r.SecretsFile != "" {
+		return []string{r.SecretsFile}
+	}
+	return append([]string(nil), r.SecretsFiles...)
+}
+
 // getValuesFiles return partial install/upgrade release command to substitute the -f flag in Helm.
 func (r *Release) getValuesFiles() []string {
 	var fileList []string
@@ -67,44 +99,25 @@ func (r *Release) getValuesFiles() []string {
 		fileList = append(fileList, r.ValuesFiles...)
 	}
 
-	if r.SecretsFile != "" || len(r.SecretsFiles) > 0 {
-		if settings.EyamlEnabled {
-			if !ToolExists("eyaml") {
-				log.Fatal("hiera-eyaml is not installed/configured correctly. Aborting!")
-			}
-		} else if settings.VaultEnabled {
-			if !helmPluginExists("vault") {
-				log.Fatal("helm vault plugin is not installed/configured correctly. Aborting!")
-			}
-		} else {
-			if !helmPluginExists("secrets") {
-				log.Fatal("helm secrets plugin is not installed/configured correctly. Aborting!")
-			}
-		}
+	if len(r.Values) > 0 {
+		fileList = append(fileList, r.getInlineValuesFile())
 	}
-	if r.SecretsFile != "" {
-		if !isOfType(r.SecretsFile, []string{".dec"}) {
-			if err := decryptSecret(r.SecretsFile); err != nil {
-				log.Fatal(err.Error())
-			}
-			r.SecretsFile += ".dec"
-		}
-		fileList = append(fileList, r.SecretsFile)
-	} else if len(r.SecretsFiles) > 0 {
-		for i := 0; i < len(r.SecretsFiles); i++ {
-			if isOfType(r.SecretsFiles[i], []string{".dec"}) {
-				// if .dec extension is added before to the secret filename, don't add it again.
-				// This happens at upgrade time (where diff and upgrade both call this function)
-				// and we don't need to decrypt the file again
-				continue
-			}
 
-			if err := decryptSecret(r.SecretsFiles[i]); err != nil {
+	secretsFiles := r.getSecretsFiles()
+	if len(secretsFiles) > 0 {
+		if err := checkSecretsBackend(settings.getSecretsBackend()); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	for _, file := range secretsFiles {
+		// files with a .dec extension are already decrypted
+		if !isOfType(file, []string{".dec"}) {
+			var err error
+			if file, err = decryptSecret(file); err != nil {
 				log.Fatal(err.Error())
 			}
-			r.SecretsFiles[i] += ".dec"
 		}
-		fileList = append(fileList, r.SecretsFiles...)
+		fileList = append(fileList, file)
 	}
 
 	fileListArgs := []string{}
@@ -9,7 +9,7 @@ func Test_release_validate(t *testing.T) {
 		Metadata:     make(map[string]string),
 		Certificates: make(map[string]string),
 		Settings:     (Config{}),
-		Namespaces:   map[string]*Namespace{"namespace": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false}},
+		Namespaces:   map[string]*Namespace{"namespace": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}}},
 		HelmRepos:    make(map[string]string),
 		Apps:         make(map[string]*Release),
 	}
@@ -422,7 +422,7 @@ func Test_release_inheritHooks(t *testing.T) {
 				"successTimeout":   "60s",
 			},
 		},
-		Namespaces: map[string]*Namespace{"namespace": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false}},
+		Namespaces: map[string]*Namespace{"namespace": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}}},
 		HelmRepos:  make(map[string]string),
 		Apps:       make(map[string]*Release),
 	}
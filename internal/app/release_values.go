@@ -0,0 +1,157 @@
+package app
+
+import (
+	"io/ioutil"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// getInlineValuesFile writes the release inline values to a temporary values file and returns its path
+func (r *Release) getInlineValuesFile() string {
+	if r.inlineValuesFile != "" {
+		return r.inlineValuesFile
+	}
+	data, err := yaml.Marshal(r.Values)
+	if err != nil {
+		log.Fatal("failed to encode the inline values of release [ " + r.Name + " ]: " + err.Error())
+	}
+	f, err := ioutil.TempFile(tempFilesDir, r.Name+"-values-*.yaml")
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		log.Fatal(err.Error())
+	}
+	r.inlineValuesFile = f.Name()
+	return r.inlineValuesFile
+}
+
+// mergeAnchoredValues deep merges the inline values that apps inherit through YAML merge keys (<<: *template)
+// into the values the apps define themselves. YAML merge keys are shallow, so without it
+// an app defining values would drop all the values of its templates.
+func mergeAnchoredValues(data string) (string, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal([]byte(data), &doc); err != nil || len(doc.Content) == 0 {
+		// let the desired state parser report the error
+		return data, nil
+	}
+	apps := mappingValue(doc.Content[0], "apps")
+	if apps == nil || apps.Kind != yamlv3.MappingNode {
+		return data, nil
+	}
+
+	changed := false
+	for i := 1; i < len(apps.Content); i += 2 {
+		app := apps.Content[i]
+		if app.Kind != yamlv3.MappingNode {
+			continue
+		}
+		own := mappingValue(app, "values")
+		if own == nil || resolveAlias(own).Kind != yamlv3.MappingNode {
+			continue
+		}
+		merged := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+		for j := 0; j+1 < len(app.Content); j += 2 {
+			if app.Content[j].Value != "<<" {
+				continue
+			}
+			for _, tpl := range mergeSources(app.Content[j+1]) {
+				if values := mappingValue(tpl, "values"); values != nil && resolveAlias(values).Kind == yamlv3.MappingNode {
+					mergeNodes(merged, values)
+				}
+			}
+		}
+		if len(merged.Content) == 0 {
+			continue
+		}
+		mergeNodes(merged, own)
+		setMappingValue(app, "values", merged)
+		changed = true
+	}
+	if !changed {
+		return data, nil
+	}
+	out, err := yamlv3.Marshal(&doc)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// mergeSources returns the mappings referenced by a merge key in the order they should be applied.
+// When a merge key references a list of mappings, the first ones take precedence.
+func mergeSources(n *yamlv3.Node) []*yamlv3.Node {
+	n = resolveAlias(n)
+	switch n.Kind {
+	case yamlv3.MappingNode:
+		return []*yamlv3.Node{n}
+	case yamlv3.SequenceNode:
+		var sources []*yamlv3.Node
+		for i := len(n.Content) - 1; i >= 0; i-- {
+			if item := resolveAlias(n.Content[i]); item.Kind == yamlv3.MappingNode {
+				sources = append(sources, item)
+			}
+		}
+		return sources
+	}
+	return nil
+}
+
+// mergeNodes deep merges the src mapping node into the dst mapping node
+func mergeNodes(dst, src *yamlv3.Node) {
+	src = resolveAlias(src)
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, val := src.Content[i].Value, resolveAlias(src.Content[i+1])
+		if existing := mappingValue(dst, key); existing != nil && existing.Kind == yamlv3.MappingNode && val.Kind == yamlv3.MappingNode {
+			mergeNodes(existing, val)
+			continue
+		}
+		setMappingValue(dst, key, copyNode(val))
+	}
+}
+
+// copyNode returns a deep copy of a node with aliases resolved and anchors removed
+func copyNode(n *yamlv3.Node) *yamlv3.Node {
+	n = resolveAlias(n)
+	c := *n
+	c.Anchor = ""
+	c.Content = make([]*yamlv3.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+func resolveAlias(n *yamlv3.Node) *yamlv3.Node {
+	for n.Kind == yamlv3.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// mappingValue returns the value node for a key in a mapping node, or nil if it's not there
+func mappingValue(n *yamlv3.Node, key string) *yamlv3.Node {
+	n = resolveAlias(n)
+	if n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets the value node for a key in a mapping node
+func setMappingValue(n *yamlv3.Node, key string, value *yamlv3.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = value
+			return
+		}
+	}
+	n.Content = append(n.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}, value)
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func Test_mergeAnchoredValues(t *testing.T) {
+	dsf := `
+appsTemplates:
+  base: &base
+    chart: repo/app
+    values:
+      image:
+        repository: app
+        tag: "1.0"
+      replicas: 1
+  monitored: &monitored
+    values:
+      metrics:
+        enabled: true
+apps:
+  app1:
+    <<: *base
+    <<: *monitored
+    values:
+      image:
+        tag: "2.0"
+  app2:
+    <<: *base
+`
+	out, err := mergeAnchoredValues(dsf)
+	if err != nil {
+		t.Fatalf("mergeAnchoredValues() error = %v", err)
+	}
+	var s State
+	if err := yaml.Unmarshal([]byte(out), &s); err != nil {
+		t.Fatalf("mergeAnchoredValues() returned invalid yaml: %v", err)
+	}
+	want := map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "app", "tag": "2.0"},
+		"replicas": float64(1),
+		"metrics":  map[string]interface{}{"enabled": true},
+	}
+	if !reflect.DeepEqual(s.Apps["app1"].Values, want) {
+		t.Errorf("mergeAnchoredValues() app1 values = %v, want %v", s.Apps["app1"].Values, want)
+	}
+	if s.Apps["app1"].Chart != "repo/app" {
+		t.Errorf("mergeAnchoredValues() app1 chart = %v, want repo/app", s.Apps["app1"].Chart)
+	}
+	if !reflect.DeepEqual(s.Apps["app2"].Values, s.AppsTemplates["base"].Values) {
+		t.Errorf("mergeAnchoredValues() app2 values = %v, want the base template values", s.Apps["app2"].Values)
+	}
+}
+
+func Test_build_mergesInlineValues(t *testing.T) {
+	teardownTestCase, err := setupStateFileTestCase(t)
+	if err != nil {
+		t.Errorf("setupStateFileTestCase(), got: %v", err)
+	}
+	defer teardownTestCase(t)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.yaml":     "helmRepos:\n  repo: https://example.com/charts\napps:\n  app:\n    namespace: default\n    chart: repo/app\n    version: 1.0.0\n    values:\n      image:\n        repository: app\n        tag: latest\n",
+		"override.toml": "[apps.app.values.image]\ntag = \"v2\"\n",
+	}
+	var fileOptions fileOptionArray
+	for _, name := range []string{"base.yaml", "override.toml"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fileOptions = append(fileOptions, fileOption{name: path})
+	}
+
+	s := new(State)
+	if err := s.build(fileOptions); err != nil {
+		t.Fatalf("build() - unexpected error: %v", err)
+	}
+	want := map[string]interface{}{"image": map[string]interface{}{"repository": "app", "tag": "v2"}}
+	if !reflect.DeepEqual(s.Apps["app"].Values, want) {
+		t.Errorf("build() - app values = %v, want %v", s.Apps["app"].Values, want)
+	}
+}
+
+func Test_getValuesFiles_inlineValues(t *testing.T) {
+	teardownTestCase, err := setupStateFileTestCase(t)
+	if err != nil {
+		t.Errorf("setupStateFileTestCase(), got: %v", err)
+	}
+	defer teardownTestCase(t)
+
+	r := &Release{
+		Name:        "app",
+		ValuesFiles: []string{"common.yaml"},
+		Values:      map[string]interface{}{"replicas": 2},
+	}
+	got := r.getValuesFiles()
+	if len(got) != 4 || got[1] != "common.yaml" || got[3] != r.inlineValuesFile {
+		t.Fatalf("getValuesFiles() = %v, want the inline values file after common.yaml", got)
+	}
+	data, err := os.ReadFile(r.inlineValuesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "replicas: 2\n" {
+		t.Errorf("getValuesFiles() inline values file content = %q", string(data))
+	}
+	if again := r.getValuesFiles(); !reflect.DeepEqual(again, got) {
+		t.Errorf("getValuesFiles() second call = %v, want %v", again, got)
+	}
+}
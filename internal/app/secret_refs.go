@@ -0,0 +1,104 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// secretRefPlaceholder matches the {{prefix: ref}} placeholders referencing secrets
+var secretRefPlaceholder = regexp.MustCompile(`{{\s*([a-z0-9-]+):\s*([^{}]*?)\s*}}`)
+
+// secretResolver resolves the reference of a {{prefix: ref}} placeholder to its value
+type secretResolver interface {
+	resolve(ref string) (string, error)
+}
+
+// secretResolverFunc adapts a function to a secretResolver
+type secretResolverFunc func(ref string) (string, error)
+
+func (f secretResolverFunc) resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// secretRefs substitutes the placeholders of the registered resolvers, keyed by prefix.
+// Every reference is resolved once per run.
+type secretRefs struct {
+	resolvers map[string]secretResolver
+	cache     map[string]string
+	mutex     sync.Mutex
+}
+
+// secrets resolves the secret references of the desired state and values files
+var secrets = newSecretRefs(map[string]secretResolver{
+	"ssm":        secretResolverFunc(resolveSSM),
+	"awssm":      secretResolverFunc(resolveAWSSecret),
+	"vault":      secretResolverFunc(resolveVault),
+	"gcpsm":      secretResolverFunc(resolveGCPSecret),
+	"azkv":       secretResolverFunc(resolveAzureKeyVault),
+	"file":       secretResolverFunc(resolveFile),
+	"env":        secretResolverFunc(resolveEnv),
+	"k8s-secret": secretResolverFunc(resolveK8sSecret),
+})
+
+func newSecretRefs(resolvers map[string]secretResolver) *secretRefs {
+	return &secretRefs{resolvers: resolvers, cache: make(map[string]string)}
+}
+
+// substitute replaces the secret references in a string with their values.
+// Placeholders with an unknown prefix are left untouched, and all the references that can't be resolved are reported at once.
+// file is the file the string was read from, relative {{file: path}} references are relative to its directory.
+func (sr *secretRefs) substitute(s, file string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	var errs []string
+	out := secretRefPlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+		m := secretRefPlaceholder.FindStringSubmatch(placeholder)
+		prefix, ref := m[1], m[2]
+		if _, ok := sr.resolvers[prefix]; !ok {
+			return placeholder
+		}
+		if prefix == "file" && !filepath.IsAbs(ref) {
+			ref = filepath.Join(filepath.Dir(file), ref)
+		}
+		value, err := sr.resolve(prefix, ref)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: can't resolve {{%s: %s}}: %v", file, prefix, m[2], err))
+			return placeholder
+		}
+		return value
+	})
+	if len(errs) > 0 {
+		return "", errors.New(strings.Join(errs, "\n"))
+	}
+	return out, nil
+}
+
+// resolve returns the value of a reference, from the cache when it was already resolved during the run
+func (sr *secretRefs) resolve(prefix, ref string) (string, error) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	key := prefix + ": " + ref
+	if value, ok := sr.cache[key]; ok {
+		return value, nil
+	}
+	value, err := sr.resolvers[prefix].resolve(ref)
+	if err != nil {
+		return "", err
+	}
+	sr.cache[key] = value
+	redactions.add(value)
+	return value, nil
+}
+
+// splitSecretKey splits a reference like path#key into the path of the secret and the key of the value in it
+func splitSecretKey(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
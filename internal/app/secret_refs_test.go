@@ -0,0 +1,146 @@
+package app
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_secretRefs_substitute(t *testing.T) {
+	calls := 0
+	sr := newSecretRefs(map[string]secretResolver{
+		"fake": secretResolverFunc(func(ref string) (string, error) {
+			calls++
+			if ref == "missing" {
+				return "", errors.New("not found")
+			}
+			return "value-of-" + ref, nil
+		}),
+		"file": secretResolverFunc(resolveFile),
+	})
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token.txt"), []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	in := "a: {{fake: one}}\nb: {{ fake: one }}\nc: {{unknown: ref}}\nd: {{ .Values.x }}\ne: {{file: token.txt}}\n"
+	got, err := sr.substitute(in, filepath.Join(dir, "dsf.yaml"))
+	if err != nil {
+		t.Fatalf("substitute() unexpected error: %v", err)
+	}
+	want := "a: value-of-one\nb: value-of-one\nc: {{unknown: ref}}\nd: {{ .Values.x }}\ne: s3cr3t\n"
+	if got != want {
+		t.Errorf("substitute() = %q, want %q", got, want)
+	}
+	if calls != 1 {
+		t.Errorf("substitute() resolved the same reference %d times, want once", calls)
+	}
+
+	_, err = sr.substitute("a: {{fake: missing}}", "dsf.yaml")
+	if err == nil || err.Error() != "dsf.yaml: can't resolve {{fake: missing}}: not found" {
+		t.Errorf("substitute() error = %v, want it to name the file and reference", err)
+	}
+}
+
+func Test_resolveVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			w.Write([]byte(`{"data": {"data": {"password": "v2-pass"}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/app":
+			w.Write([]byte(`{"data": {"password": "v1-pass", "port": 5432}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+
+	tests := map[string]string{
+		"secret/data/app#password": "v2-pass",
+		"kv/app#password":          "v1-pass",
+		"kv/app#port":              "5432",
+	}
+	for ref, want := range tests {
+		if got, err := resolveVault(ref); err != nil || got != want {
+			t.Errorf("resolveVault(%s) = %s, %v, want %s", ref, got, err, want)
+		}
+	}
+	if _, err := resolveVault("kv/missing#password"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("resolveVault() error = %v, want a not found error", err)
+	}
+	if _, err := resolveVault("kv/app"); err == nil {
+		t.Errorf("resolveVault() expected an error for a reference without a key")
+	}
+}
+
+func Test_resolveGCPSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gcp-token" || r.URL.Path != "/v1/projects/my-project/secrets/db/versions/latest:access" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"payload": {"data": "` + base64.StdEncoding.EncodeToString([]byte(`{"user": "admin"}`)) + `"}}`))
+	}))
+	defer server.Close()
+	t.Setenv("HELMSMAN_GCPSM_ENDPOINT", server.URL)
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "gcp-token")
+
+	if got, err := resolveGCPSecret("my-project/db#user"); err != nil || got != "admin" {
+		t.Errorf("resolveGCPSecret() = %s, %v, want admin", got, err)
+	}
+	if _, err := resolveGCPSecret("db"); err == nil {
+		t.Errorf("resolveGCPSecret() expected an error for a reference without a project")
+	}
+}
+
+func Test_resolveAzureKeyVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/tenant/oauth2/v2.0/token":
+			r.ParseForm()
+			if r.PostForm.Get("client_secret") != "client-secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"access_token": "az-token"}`))
+		case r.URL.Path == "/secrets/db-password" && r.Header.Get("Authorization") == "Bearer az-token":
+			w.Write([]byte(`{"value": "az-pass"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("HELMSMAN_AZKV_ENDPOINT", server.URL)
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	t.Setenv("AZURE_CLIENT_ID", "client")
+	t.Setenv("AZURE_CLIENT_SECRET", "client-secret")
+	azureToken = ""
+	defer func() { azureToken = "" }()
+
+	if got, err := resolveAzureKeyVault("my-vault/db-password"); err != nil || got != "az-pass" {
+		t.Errorf("resolveAzureKeyVault() = %s, %v, want az-pass", got, err)
+	}
+}
+
+func Test_resolveEnv(t *testing.T) {
+	t.Setenv("HELMSMAN_TEST_SECRET", "from-env")
+	if got, err := resolveEnv("HELMSMAN_TEST_SECRET"); err != nil || got != "from-env" {
+		t.Errorf("resolveEnv() = %s, %v, want from-env", got, err)
+	}
+	if _, err := resolveEnv("HELMSMAN_TEST_UNSET_SECRET"); err == nil {
+		t.Errorf("resolveEnv() expected an error for an unset variable")
+	}
+}
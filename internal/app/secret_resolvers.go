@@ -0,0 +1,327 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+
+	"github.com/Praqma/helmsman/internal/aws"
+)
+
+const (
+	defaultGCPSecretManagerEndpoint = "https://secretmanager.googleapis.com"
+	defaultAzureAuthorityHost       = "https://login.microsoftonline.com"
+	azureKeyVaultResource           = "https://vault.azure.net"
+	azureKeyVaultAPIVersion         = "7.4"
+)
+
+var (
+	secretsHTTPClient = &http.Client{Timeout: 30 * time.Second}
+	azureTokenMutex   sync.Mutex
+	azureToken        string
+)
+
+// resolveSSM resolves {{ssm: name}} from the AWS SSM parameter store, {{ssm: name~true}} decrypts the parameter
+func resolveSSM(ref string) (string, error) {
+	name, decrypt, found := strings.Cut(ref, "~")
+	withDecryption := false
+	if found {
+		var err error
+		if withDecryption, err = strconv.ParseBool(decrypt); err != nil {
+			return "", fmt.Errorf("invalid decryption argument [ %s ]", decrypt)
+		}
+	}
+	return aws.GetSSMParam(name, withDecryption)
+}
+
+// resolveAWSSecret resolves {{awssm: secret-id}} from AWS Secrets Manager, {{awssm: secret-id#key}} picks a key of a JSON secret
+func resolveAWSSecret(ref string) (string, error) {
+	id, key := splitSecretKey(ref)
+	value, err := aws.GetSecret(id)
+	if err != nil {
+		return "", err
+	}
+	return secretField(value, key)
+}
+
+// resolveVault resolves {{vault: path#key}} from a Vault KV v1 or v2 secrets engine, using VAULT_ADDR and VAULT_TOKEN.
+// KV v2 paths include the data segment, e.g. secret/data/myapp#password.
+func resolveVault(ref string) (string, error) {
+	path, key := splitSecretKey(ref)
+	if key == "" {
+		return "", fmt.Errorf("the key of the secret is missing, e.g. %s#password", path)
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			data, _ := os.ReadFile(filepath.Join(home, ".vault-token"))
+			token = strings.TrimSpace(string(data))
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := getJSON(req, &body); err != nil {
+		return "", err
+	}
+
+	data := body.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, v2 := data["metadata"]; v2 {
+			data = inner
+		}
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key [ %s ] not found", key)
+	}
+	return stringifySecret(value)
+}
+
+// resolveGCPSecret resolves {{gcpsm: project/secret}} or {{gcpsm: project/secret/version}} from GCP Secret Manager,
+// {{gcpsm: project/secret#key}} picks a key of a JSON secret.
+// It uses GOOGLE_OAUTH_ACCESS_TOKEN or the application default credentials.
+func resolveGCPSecret(ref string) (string, error) {
+	path, key := splitSecretKey(ref)
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("the reference should be project/secret or project/secret/version")
+	}
+	version := "latest"
+	if len(parts) == 3 {
+		version = parts[2]
+	}
+	endpoint := os.Getenv("HELMSMAN_GCPSM_ENDPOINT")
+	if endpoint == "" {
+		endpoint = defaultGCPSecretManagerEndpoint
+	}
+
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		ts, err := google.DefaultTokenSource(context.Background(), "https://www.googleapis.com/auth/cloud-platform")
+		if err != nil {
+			return "", fmt.Errorf("can't authenticate to GCP: %w", err)
+		}
+		t, err := ts.Token()
+		if err != nil {
+			return "", fmt.Errorf("can't authenticate to GCP: %w", err)
+		}
+		token = t.AccessToken
+	}
+
+	u := fmt.Sprintf("%s/v1/projects/%s/secrets/%s/versions/%s:access", strings.TrimSuffix(endpoint, "/"),
+		url.PathEscape(parts[0]), url.PathEscape(parts[1]), url.PathEscape(version))
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var body struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := getJSON(req, &body); err != nil {
+		return "", err
+	}
+	value, err := base64.StdEncoding.DecodeString(body.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret payload: %w", err)
+	}
+	return secretField(string(value), key)
+}
+
+// resolveAzureKeyVault resolves {{azkv: vault/secret}} or {{azkv: vault/secret/version}} from Azure Key Vault,
+// {{azkv: vault/secret#key}} picks a key of a JSON secret.
+// It authenticates with AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET, or with the az CLI.
+func resolveAzureKeyVault(ref string) (string, error) {
+	path, key := splitSecretKey(ref)
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("the reference should be vault/secret or vault/secret/version")
+	}
+	endpoint := os.Getenv("HELMSMAN_AZKV_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://" + parts[0] + ".vault.azure.net"
+	}
+	u := strings.TrimSuffix(endpoint, "/") + "/secrets/" + url.PathEscape(parts[1])
+	if len(parts) == 3 {
+		u += "/" + url.PathEscape(parts[2])
+	}
+
+	token, err := getAzureKeyVaultToken()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, u+"?api-version="+azureKeyVaultAPIVersion, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var body struct {
+		Value string `json:"value"`
+	}
+	if err := getJSON(req, &body); err != nil {
+		return "", err
+	}
+	return secretField(body.Value, key)
+}
+
+// getAzureKeyVaultToken gets an access token for Azure Key Vault, once per run
+func getAzureKeyVaultToken() (string, error) {
+	azureTokenMutex.Lock()
+	defer azureTokenMutex.Unlock()
+	if azureToken != "" {
+		return azureToken, nil
+	}
+
+	tenant, clientID, secret := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET")
+	if tenant == "" || clientID == "" || secret == "" {
+		cmd := Command{
+			Cmd:         "az",
+			Args:        []string{"account", "get-access-token", "--resource", azureKeyVaultResource, "--query", "accessToken", "--output", "tsv"},
+			Description: "Getting an access token for Azure Key Vault",
+		}
+		res, err := cmd.Exec()
+		if err != nil {
+			return "", fmt.Errorf("can't authenticate to Azure, set AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET or log in with the az CLI: %w", err)
+		}
+		azureToken = strings.TrimSpace(res.output)
+		return azureToken, nil
+	}
+
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = defaultAzureAuthorityHost
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"scope":         {azureKeyVaultResource + "/.default"},
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(authority, "/")+"/"+url.PathEscape(tenant)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := getJSON(req, &body); err != nil {
+		return "", fmt.Errorf("can't authenticate to Azure: %w", err)
+	}
+	azureToken = body.AccessToken
+	return azureToken, nil
+}
+
+// resolveFile resolves {{file: path}} to the content of a file, without its trailing new line
+func resolveFile(ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+}
+
+// resolveEnv resolves {{env: NAME}} to the value of an env variable, which has to be set
+func resolveEnv(ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("env variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+// resolveK8sSecret resolves {{k8s-secret: namespace/name#key}} from a secret of the current kubectl context
+func resolveK8sSecret(ref string) (string, error) {
+	path, key := splitSecretKey(ref)
+	ns, name, found := strings.Cut(path, "/")
+	if !found || key == "" {
+		return "", fmt.Errorf("the reference should be namespace/name#key")
+	}
+	cmd := kubectl([]string{"get", "secret", name, "--namespace", ns, "--output", "json"}, "Getting secret [ "+name+" ] in namespace [ "+ns+" ]")
+	res, err := cmd.Exec()
+	if err != nil {
+		return "", err
+	}
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(res.output), &secret); err != nil {
+		return "", err
+	}
+	encoded, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key [ %s ] not found", key)
+	}
+	value, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// getJSON sends a request and decodes its JSON response
+func getJSON(req *http.Request, v interface{}) error {
+	resp, err := secretsHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// secretField returns the secret, or the value of one of its keys when the secret is a JSON object
+func secretField(secret, key string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("the secret is not a JSON object, can't get key [ %s ]", key)
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("key [ %s ] not found", key)
+	}
+	return stringifySecret(value)
+}
+
+// stringifySecret returns a secret value as a string, JSON encoding values that are not strings
+func stringifySecret(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getsops/sops/v3/decrypt"
+)
+
+// secrets backends used to decrypt secrets files
+const (
+	secretsBackendSOPS        = "sops"
+	secretsBackendHelmSecrets = "helm-secrets"
+	secretsBackendEyaml       = "eyaml"
+	secretsBackendHelmVault   = "helm-vault"
+)
+
+var secretsBackends = []string{secretsBackendSOPS, secretsBackendHelmSecrets, secretsBackendEyaml, secretsBackendHelmVault}
+
+// getSecretsBackend returns the backend used to decrypt secrets files.
+// eyamlEnabled and vaultEnabled select their backends when secretsBackend is not set, otherwise SOPS is used natively.
+func (c *Config) getSecretsBackend() string {
+	switch {
+	case c.SecretsBackend != "":
+		return c.SecretsBackend
+	case c.EyamlEnabled:
+		return secretsBackendEyaml
+	case c.VaultEnabled:
+		return secretsBackendHelmVault
+	default:
+		return secretsBackendSOPS
+	}
+}
+
+// validateSecretsBackend checks that the secrets backend is known and doesn't contradict eyamlEnabled or vaultEnabled
+func (c *Config) validateSecretsBackend() error {
+	if c.SecretsBackend == "" {
+		if c.EyamlEnabled && c.VaultEnabled {
+			return fmt.Errorf("eyamlEnabled and vaultEnabled can't be used together")
+		}
+		return nil
+	}
+	if !stringInSlice(c.SecretsBackend, secretsBackends) {
+		return fmt.Errorf("secretsBackend must be one of: %s", strings.Join(secretsBackends, ", "))
+	}
+	if c.EyamlEnabled && c.SecretsBackend != secretsBackendEyaml {
+		return fmt.Errorf("eyamlEnabled can't be used with secretsBackend [ %s ]", c.SecretsBackend)
+	}
+	if c.VaultEnabled && c.SecretsBackend != secretsBackendHelmVault {
+		return fmt.Errorf("vaultEnabled can't be used with secretsBackend [ %s ]", c.SecretsBackend)
+	}
+	return nil
+}
+
+// checkSecretsBackend checks that the tool needed by a secrets backend is installed, SOPS is built in
+func checkSecretsBackend(backend string) error {
+	switch backend {
+	case secretsBackendEyaml:
+		if !ToolExists("eyaml") {
+			return fmt.Errorf("hiera-eyaml is not installed/configured correctly. Aborting!")
+		}
+	case secretsBackendHelmVault:
+		if !helmPluginExists("vault") {
+			return fmt.Errorf("helm vault plugin is not installed/configured correctly. Aborting!")
+		}
+	case secretsBackendHelmSecrets:
+		if !helmPluginExists("secrets") {
+			return fmt.Errorf("helm secrets plugin is not installed/configured correctly. Aborting!")
+		}
+	}
+	return nil
+}
+
+// decryptSOPS decrypts a SOPS encrypted file into the private directory of the decrypted secrets and returns the decrypted file.
+// The keys are found the same way the sops CLI finds them: age keys from SOPS_AGE_KEY_FILE or the default keys file,
+// PGP keys from the gpg keyring and cloud KMS keys from the cloud credentials of the environment.
+func decryptSOPS(name string) (string, error) {
+	cleartext, err := decrypt.File(name, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt [ %s ] with sops: %w", name, err)
+	}
+	file, err := decrypted.write(name, string(cleartext))
+	if err != nil {
+		return "", fmt.Errorf("can't write the decrypted [ %s ] file: %w", name, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_config_getSecretsBackend(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   string
+	}{
+		{config: Config{}, want: secretsBackendSOPS},
+		{config: Config{EyamlEnabled: true}, want: secretsBackendEyaml},
+		{config: Config{VaultEnabled: true}, want: secretsBackendHelmVault},
+		{config: Config{SecretsBackend: secretsBackendHelmSecrets}, want: secretsBackendHelmSecrets},
+	}
+	for _, tt := range tests {
+		if got := tt.config.getSecretsBackend(); got != tt.want {
+			t.Errorf("getSecretsBackend() = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func Test_config_validateSecretsBackend(t *testing.T) {
+	tests := []struct {
+		config  Config
+		wantErr bool
+	}{
+		{config: Config{}},
+		{config: Config{SecretsBackend: secretsBackendSOPS}},
+		{config: Config{SecretsBackend: secretsBackendEyaml, EyamlEnabled: true}},
+		{config: Config{SecretsBackend: "gpg"}, wantErr: true},
+		{config: Config{SecretsBackend: secretsBackendSOPS, EyamlEnabled: true}, wantErr: true},
+		{config: Config{SecretsBackend: secretsBackendHelmSecrets, VaultEnabled: true}, wantErr: true},
+		{config: Config{EyamlEnabled: true, VaultEnabled: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.validateSecretsBackend(); (err != nil) != tt.wantErr {
+			t.Errorf("validateSecretsBackend(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func Test_decryptSecret_sops(t *testing.T) {
+	keyFile, _ := filepath.Abs("../../tests/keys/age.key")
+	data, err := os.ReadFile("../../tests/secrets/valid_sops_secrets.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretsFile := filepath.Join(t.TempDir(), "secrets.yaml")
+	if err := os.WriteFile(secretsFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	settings = &Config{}
+	defer decrypted.remove()
+
+	t.Setenv("SOPS_AGE_KEY_FILE", keyFile)
+	file, err := decryptSecret(secretsFile)
+	if err != nil {
+		t.Fatalf("decryptSecret() unexpected error: %v", err)
+	}
+	content, _ := os.ReadFile(file)
+	if !strings.Contains(string(content), "password: s3cr3t") {
+		t.Errorf("decryptSecret() wrote %s, want the decrypted secrets", content)
+	}
+	if _, err := os.Stat(secretsFile + ".dec"); err == nil {
+		t.Errorf("decryptSecret() wrote the decrypted secrets next to the secrets file")
+	}
+	if info, err := os.Stat(filepath.Dir(file)); err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf("decryptSecret() wrote to %s, want a private directory", filepath.Dir(file))
+	}
+	if again, _ := decryptSecret(secretsFile); again != file {
+		t.Errorf("decryptSecret() = %s the second time, want the already decrypted %s", again, file)
+	}
+	decrypted.remove()
+	if _, err := os.Stat(file); err == nil {
+		t.Errorf("decrypted.remove() left %s behind", file)
+	}
+
+	t.Setenv("SOPS_AGE_KEY_FILE", filepath.Join(t.TempDir(), "missing.key"))
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, err := decryptSecret(secretsFile); err == nil {
+		t.Errorf("decryptSecret() expected an error without the age key")
+	}
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// sharedMemoryDir is a tmpfs on most Linux systems, files written there never reach the disk
+const sharedMemoryDir = "/dev/shm"
+
+// decryptedSecrets keeps the decrypted secrets files in a private directory, outside of the DSF checkout.
+// Every secrets file is decrypted once per run.
+type decryptedSecrets struct {
+	dir   string
+	files map[string]string
+	mutex sync.Mutex
+}
+
+var decrypted = &decryptedSecrets{files: make(map[string]string)}
+
+// secretsDirParent returns where the private directory is created, a tmpfs when available
+func secretsDirParent() string {
+	if info, err := os.Stat(sharedMemoryDir); err == nil && info.IsDir() {
+		if f, err := os.CreateTemp(sharedMemoryDir, ".helmsman-*"); err == nil {
+			f.Close()
+			os.Remove(f.Name())
+			return sharedMemoryDir
+		}
+	}
+	return os.TempDir()
+}
+
+// path returns the path the decrypted content of a secrets file is written to, creating the private directory when needed.
+// The path is stable during the run, so a file already decrypted can be reused.
+func (d *decryptedSecrets) path(name string) (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.dir == "" {
+		dir, err := os.MkdirTemp(secretsDirParent(), "helmsman-secrets-")
+		if err != nil {
+			return "", fmt.Errorf("can't create a private directory for the decrypted secrets: %w", err)
+		}
+		d.dir = dir
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		abs = name
+	}
+	sum := sha256.Sum256([]byte(abs))
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	return filepath.Join(d.dir, base+"-"+hex.EncodeToString(sum[:6])+".yaml.dec"), nil
+}
+
+// lookup returns the decrypted file of a secrets file, if it was already decrypted during the run
+func (d *decryptedSecrets) lookup(name string) (string, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	file, ok := d.files[name]
+	return file, ok
+}
+
+// add records the decrypted file of a secrets file
+func (d *decryptedSecrets) add(name, file string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.files[name] = file
+}
+
+// write writes decrypted content to the private directory, only readable by the current user
+func (d *decryptedSecrets) write(name, content string) (string, error) {
+	file, err := d.writePrivate(name, content)
+	if err != nil {
+		return "", err
+	}
+	d.add(name, file)
+	redactions.addYAML(content)
+	return file, nil
+}
+
+// writePrivate writes content to the private directory without registering its values as secrets,
+// for content whose secret values are already redacted, such as the manifests of k8s Secrets
+func (d *decryptedSecrets) writePrivate(name, content string) (string, error) {
+	file, err := d.path(name)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.WriteString(f, content); err != nil {
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// move moves a file decrypted by a plugin next to its source into the private directory, removing the original
+func (d *decryptedSecrets) move(name, src string) (string, error) {
+	data, err := os.ReadFile(src)
+	removeErr := os.Remove(src)
+	if err != nil {
+		return "", err
+	}
+	if removeErr != nil {
+		return "", fmt.Errorf("can't remove the decrypted file [ %s ]: %w", src, removeErr)
+	}
+	return d.write(name, string(data))
+}
+
+// remove deletes the private directory and all the decrypted files in it
+func (d *decryptedSecrets) remove() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.dir != "" {
+		os.RemoveAll(d.dir)
+		d.dir = ""
+	}
+	d.files = make(map[string]string)
+}
+
+// removeOnSignal deletes the decrypted secrets and temp files when helmsman is interrupted or terminated
+func removeOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-c
+		removeTempFiles()
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		os.Exit(code)
+	}()
+}
+
+// removeTempFiles deletes the decrypted secrets and the temp files, which hold values with substituted env vars and secret references
+func removeTempFiles() {
+	decrypted.remove()
+	os.RemoveAll(tempFilesDir)
+}
+
+// cleanupOnPanic deletes the decrypted secrets and the temp files when a goroutine panics, then panics again.
+// The deferred calls of main only run for panics of the main goroutine, so every goroutine defers it.
+func cleanupOnPanic() {
+	if r := recover(); r != nil {
+		removeTempFiles()
+		panic(r)
+	}
+}
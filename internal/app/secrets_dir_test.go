@@ -0,0 +1,38 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_cleanupOnPanic(t *testing.T) {
+	if err := os.MkdirAll(tempFilesDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempFilesDir)
+	defer decrypted.remove()
+	if err := os.WriteFile(filepath.Join(tempFilesDir, "values.yaml"), []byte("password: secret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := decrypted.write("secrets.yaml", "password: secret\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repanicked := make(chan interface{})
+	go func() {
+		defer func() { repanicked <- recover() }()
+		defer cleanupOnPanic()
+		panic("boom")
+	}()
+	if got := <-repanicked; got != "boom" {
+		t.Errorf("cleanupOnPanic() re-panicked with %v, want boom", got)
+	}
+	if _, err := os.Stat(tempFilesDir); !os.IsNotExist(err) {
+		t.Errorf("cleanupOnPanic() did not remove %s", tempFilesDir)
+	}
+	if _, err := os.Stat(secret); !os.IsNotExist(err) {
+		t.Errorf("cleanupOnPanic() did not remove the decrypted secret %s", secret)
+	}
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// label selector operators, following the Kubernetes label selector syntax
+const (
+	selectorEquals       = "="
+	selectorNotEquals    = "!="
+	selectorIn           = "in"
+	selectorNotIn        = "notin"
+	selectorExists       = "exists"
+	selectorDoesNotExist = "!"
+)
+
+var (
+	selectorSetTerm  = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+	labelKeyFormat   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_./]*[A-Za-z0-9])?$`)
+	labelValueFormat = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$`)
+)
+
+// labelRequirement is a single term of a label selector, e.g. tier=backend or team in (a,b)
+type labelRequirement struct {
+	key      string
+	operator string
+	values   []string
+}
+
+// labelSelector selects apps whose labels match all of its requirements
+type labelSelector []labelRequirement
+
+// parseSelector parses a Kubernetes style label selector, e.g. "tier=backend,env!=prod,team in (a,b),!legacy"
+func parseSelector(selector string) (labelSelector, error) {
+	var ls labelSelector
+	for _, term := range splitSelector(selector) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return nil, fmt.Errorf("invalid selector [ %s ]: empty requirement", selector)
+		}
+		req, err := parseRequirement(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector [ %s ]: %w", selector, err)
+		}
+		ls = append(ls, req)
+	}
+	return ls, nil
+}
+
+// splitSelector splits a selector on the commas that are not inside a set of values
+func splitSelector(selector string) []string {
+	var (
+		terms []string
+		depth int
+		start int
+	)
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, selector[start:])
+}
+
+func parseRequirement(term string) (labelRequirement, error) {
+	var req labelRequirement
+	switch {
+	case strings.HasPrefix(term, "!") && !strings.Contains(term, "="):
+		req = labelRequirement{key: strings.TrimSpace(term[1:]), operator: selectorDoesNotExist}
+	case selectorSetTerm.MatchString(term):
+		m := selectorSetTerm.FindStringSubmatch(term)
+		req = labelRequirement{key: m[1], operator: m[2]}
+		for _, v := range strings.Split(m[3], ",") {
+			req.values = append(req.values, strings.TrimSpace(v))
+		}
+	case strings.Contains(term, "!="):
+		kv := strings.SplitN(term, "!=", 2)
+		req = labelRequirement{key: strings.TrimSpace(kv[0]), operator: selectorNotEquals, values: []string{strings.TrimSpace(kv[1])}}
+	case strings.Contains(term, "="):
+		kv := strings.SplitN(strings.Replace(term, "==", "=", 1), "=", 2)
+		req = labelRequirement{key: strings.TrimSpace(kv[0]), operator: selectorEquals, values: []string{strings.TrimSpace(kv[1])}}
+	default:
+		req = labelRequirement{key: term, operator: selectorExists}
+	}
+
+	if !labelKeyFormat.MatchString(req.key) {
+		return req, fmt.Errorf("invalid label key [ %s ] in [ %s ]", req.key, term)
+	}
+	for _, v := range req.values {
+		if !labelValueFormat.MatchString(v) {
+			return req, fmt.Errorf("invalid label value [ %s ] in [ %s ]", v, term)
+		}
+	}
+	return req, nil
+}
+
+// matches checks if the given labels satisfy all the requirements of the selector
+func (ls labelSelector) matches(labels map[string]string) bool {
+	for _, req := range ls {
+		if !req.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (req labelRequirement) matches(labels map[string]string) bool {
+	value, exists := labels[req.key]
+	switch req.operator {
+	case selectorEquals:
+		return exists && value == req.values[0]
+	case selectorNotEquals:
+		return !exists || value != req.values[0]
+	case selectorIn:
+		return exists && stringInSlice(value, req.values)
+	case selectorNotIn:
+		return !exists || !stringInSlice(value, req.values)
+	case selectorExists:
+		return exists
+	case selectorDoesNotExist:
+		return !exists
+	}
+	return false
+}
+
+// parseSelectors parses all the selectors passed with --selector
+func parseSelectors(selectors []string) ([]labelSelector, error) {
+	var result []labelSelector
+	for _, s := range selectors {
+		ls, err := parseSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ls)
+	}
+	return result, nil
+}
+
+// isGlobPattern checks if a --target value is a glob pattern rather than an app name
+func isGlobPattern(target string) bool {
+	return strings.ContainsAny(target, "*?[")
+}
+
+// matchesTarget checks if an app name matches a --target value, which can be an app name or a glob pattern
+func matchesTarget(name, target string) bool {
+	if !isGlobPattern(target) {
+		return name == target
+	}
+	matched, _ := path.Match(target, name)
+	return matched
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func Test_parseSelector(t *testing.T) {
+	labels := map[string]string{"tier": "backend", "env": "staging", "team": "a"}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"tier=backend", true},
+		{"tier==backend", true},
+		{"tier=frontend", false},
+		{"env!=prod", true},
+		{"missing!=prod", true},
+		{"team in (a,b)", true},
+		{"team in (b, c)", false},
+		{"team notin (b,c)", true},
+		{"tier", true},
+		{"missing", false},
+		{"!missing", true},
+		{"!tier", false},
+		{"tier=backend,env!=prod,team in (a,b)", true},
+		{"tier=backend, env=prod", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			ls, err := parseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("parseSelector() unexpected error: %v", err)
+			}
+			if got := ls.matches(labels); got != tt.want {
+				t.Errorf("parseSelector(%q).matches() = %v, want %v", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseSelector_errors(t *testing.T) {
+	for _, selector := range []string{"", "tier=backend,", "=backend", "team in (a b)", "tier=back end"} {
+		if _, err := parseSelector(selector); err == nil {
+			t.Errorf("parseSelector(%q) expected an error", selector)
+		}
+	}
+}
+
+func Test_state_disableApps_selectorsAndGlobs(t *testing.T) {
+	tests := []struct {
+		name      string
+		targets   []string
+		excluded  []string
+		selectors []string
+		want      []string
+	}{
+		{
+			name:      "selector",
+			selectors: []string{"tier=backend"},
+			want:      []string{"api", "worker"},
+		}, {
+			name:      "multiple selectors",
+			selectors: []string{"tier=backend,team=payments", "tier=frontend"},
+			want:      []string{"api", "web"},
+		}, {
+			name:    "glob target",
+			targets: []string{"w*"},
+			want:    []string{"web", "worker"},
+		}, {
+			name:      "glob target and selector",
+			targets:   []string{"a?i"},
+			selectors: []string{"tier=frontend"},
+			want:      []string{"api", "web"},
+		}, {
+			name:     "glob excluded target",
+			excluded: []string{"w*"},
+			want:     []string{"api"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &State{
+				Namespaces: map[string]*Namespace{"backend": {}, "frontend": {}},
+				Apps: map[string]*Release{
+					"api":    {Name: "api", Namespace: "backend", Enabled: True, Labels: map[string]string{"tier": "backend", "team": "payments"}},
+					"worker": {Name: "worker", Namespace: "backend", Enabled: True, Labels: map[string]string{"tier": "backend"}},
+					"web":    {Name: "web", Namespace: "frontend", Enabled: True, Labels: map[string]string{"tier": "frontend"}},
+				},
+			}
+			selectors, err := parseSelectors(tt.selectors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.disableApps(nil, tt.targets, nil, tt.excluded, selectors)
+			var got []string
+			for name, app := range s.Apps {
+				if app.isConsideredToRun() {
+					got = append(got, name)
+				}
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("disableApps() selected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
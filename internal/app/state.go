@@ -36,6 +36,14 @@ type Config struct {
 	BearerTokenPath string `json:"bearerTokenPath,omitempty"`
 	// NamespaceLabelsAuthoritativei indicates whether helmsman should remove namespace labels that are not in the DSF
 	NamespaceLabelsAuthoritative bool `json:"namespaceLabelsAuthoritative,omitempty"`
+	// NamespacesAuthoritative indicates whether helmsman should delete the namespaces it created that are no longer in the DSF
+	NamespacesAuthoritative bool `json:"namespacesAuthoritative,omitempty"`
+	// NamespacesDeletionAllowList lists the namespaces, or glob patterns, that can be deleted when NamespacesAuthoritative is set
+	NamespacesDeletionAllowList []string `json:"namespacesDeletionAllowList,omitempty"`
+	// SensitiveEnvVars lists the env variables holding secrets, their values are redacted from the output
+	SensitiveEnvVars []string `json:"sensitiveEnvVars,omitempty"`
+	// SecretsBackend is the tool used to decrypt secrets files: sops (built in, the default), helm-secrets, eyaml or helm-vault
+	SecretsBackend string `json:"secretsBackend,omitempty"`
 	// VaultEnabled indicates whether the helm vault plugin is used for encrypted files
 	VaultEnabled bool `json:"vaultEnabled,omitempty"`
 	// VaultDeliminator allows secret deliminator used when parsing to be overridden
@@ -94,23 +102,37 @@ type State struct {
 	Namespaces map[string]*Namespace `json:"namespaces"`
 	// Apps holds the configuration for each helm release managed by helmsman
 	Apps map[string]*Release `json:"apps"`
-	// AppsTemplates allow defining YAML objects thatcan be used as a reference with YAML anchors to keep the configuration DRY
+	// AppsTemplates allow defining shared app settings that apps inherit with the template field, or with YAML anchors, to keep the configuration DRY
 	AppsTemplates map[string]*Release `json:"appsTemplates,omitempty"`
-	targetMap     map[string]bool
-	chartInfo     map[string]map[string]*ChartInfo
+	// NamespaceTemplates allow defining shared namespace settings that namespaces inherit with the template field
+	NamespaceTemplates map[string]*Namespace `json:"namespaceTemplates,omitempty"`
+	// Clusters to deploy the desired state to, each of them can override apps
+	Clusters    map[string]*Cluster `json:"clusters,omitempty"`
+	targetMap   map[string]bool
+	chartInfo   map[string]map[string]*ChartInfo
+	appsSources map[string]map[string][]string
+	// versionConstraints holds the version constraints of the apps pinned to the versions in the lock file
+	versionConstraints map[string]string
 }
 
-func (s *State) init() {
+func (s *State) init() error {
+	if err := s.expandNamespaces(); err != nil {
+		return err
+	}
 	s.setDefaults()
 	s.initializeNamespaces()
+	return nil
 }
 
+// defaultStorageBackend is the storage backend helm uses when HELM_DRIVER is not set
+const defaultStorageBackend = "secret"
+
 func (s *State) setDefaults() {
 	if s.Settings.StorageBackend != "" {
 		os.Setenv("HELM_DRIVER", s.Settings.StorageBackend)
 	} else {
 		// set default storage background to secret if not set by user
-		s.Settings.StorageBackend = "secret"
+		s.Settings.StorageBackend = defaultStorageBackend
 	}
 
 	// if there is no user-defined context name in the DSF(s), use the default context name
@@ -123,7 +145,8 @@ func (s *State) setDefaults() {
 		if r.Name == "" {
 			r.Name = name
 		}
-		// inherit globalHooks if local ones are not set
+		// inherit the namespace defaults, then globalHooks, if local ones are not set
+		r.inheritNamespaceDefaults(s)
 		r.inheritHooks(s)
 		r.inheritMaxHistory(s)
 	}
@@ -146,9 +169,17 @@ func (s *State) validate() error {
 		os.Exit(0)
 	}
 
+	// clusters
+	for name, c := range s.Clusters {
+		if c == nil || c.KubeContext == "" {
+			return errors.New("clusters validation failed -- cluster [ " + name + " ] has no kubeContext")
+		}
+	}
+
 	// settings
 	// use reflect.DeepEqual to compare Settings are empty, since it contains a map
-	if (reflect.DeepEqual(s.Settings, Config{}) || s.Settings.KubeContext == "") && !getKubeContext() {
+	// when running against multiple clusters, each cluster brings its own kubeContext
+	if len(s.Clusters) == 0 && (reflect.DeepEqual(s.Settings, Config{}) || s.Settings.KubeContext == "") && !getKubeContext() {
 		return errors.New("settings validation failed -- you have not defined a " +
 			"kubeContext to use. Either define it in the desired state file or pass a kubeconfig with --kubeconfig to use an existing context")
 	}
@@ -186,6 +217,11 @@ func (s *State) validate() error {
 		}
 	}
 
+	// secrets backend validation
+	if err := s.Settings.validateSecretsBackend(); err != nil {
+		return fmt.Errorf("settings validation failed -- %w", err)
+	}
+
 	// slack webhook validation (if provided)
 	if s.Settings.SlackWebhook != "" {
 		if _, err := url.ParseRequestURI(s.Settings.SlackWebhook); err != nil {
@@ -242,6 +278,11 @@ func (s *State) validate() error {
 		if s.Namespaces == nil || len(s.Namespaces) == 0 {
 			return errors.New("namespaces validation failed -- at least one namespace is required")
 		}
+		for name, ns := range s.Namespaces {
+			if err := ns.validate(); err != nil {
+				return fmt.Errorf("namespaces validation failed -- for namespace [ "+name+" ]. %w", err)
+			}
+		}
 	} else {
 		log.Info("ns-override is used to override all namespaces with [ " + flags.nsOverride + " ] Skipping defined namespaces validation.")
 	}
@@ -304,16 +345,30 @@ func (s *State) getReleaseChartsInfo() error {
 			sem <- struct{}{}
 			wg.Add(1)
 			go func(apps, chart, version string) {
+				defer cleanupOnPanic()
 				defer func() {
 					wg.Done()
 					<-sem
 				}()
 
-				info, err := getChartInfo(chart, version)
+				validateValues := !flags.skipValidation && !flags.destroy
+				var info *ChartInfo
+				var err error
+				if validateValues && !isLocalChart(chart) {
+					// the chart is pulled once to read both its information and its values
+					info, err = pullChartInfo(chart, version)
+				} else {
+					info, err = getChartInfo(chart, version)
+				}
 				if err != nil {
 					chartErrors <- err
 				} else {
 					log.Verbose(fmt.Sprintf("Extracted chart information from chart [ %s ] with version [ %s ]: %s %s", chart, version, info.Name, info.Version))
+					if validateValues && isLocalChart(chart) {
+						if err := info.loadValues(chart); err != nil {
+							log.Warning(fmt.Sprintf("Could not read values of chart [ %s ] with version [ %s ], skipping values validation: %v", chart, version, err))
+						}
+					}
 					mutex.Lock()
 					s.chartInfo[chart][version] = info
 					mutex.Unlock()
@@ -335,6 +390,19 @@ func (s *State) getReleaseChartsInfo() error {
 	if fail {
 		return errors.New("chart validation failed")
 	}
+
+	for _, r := range s.Apps {
+		if !r.isConsideredToRun() || !r.Enabled.Value {
+			continue
+		}
+		if err := r.validateValues(s.chartInfo[r.Chart][r.Version]); err != nil {
+			fail = true
+			log.Error(err.Error())
+		}
+	}
+	if fail {
+		return errors.New("values validation failed")
+	}
 	return nil
 }
 
@@ -353,8 +421,9 @@ func (s *State) overrideAppsNamespace(newNs string) {
 }
 
 // disable Apps defined as excluded by either their name or their group
-// then get only those Apps that exist in TargetMap
-func (s *State) disableApps(groups, targets, groupsExcluded, targetsExcluded []string) {
+// then get only those Apps that exist in TargetMap, belong to one of the groups or match one of the label selectors.
+// Targets can be app names or glob patterns.
+func (s *State) disableApps(groups, targets, groupsExcluded, targetsExcluded []string, selectors []labelSelector) {
 excludeAppsLoop:
 	for _, app := range s.Apps {
 		for _, groupExcluded := range groupsExcluded {
@@ -364,7 +433,7 @@ excludeAppsLoop:
 			}
 		}
 		for _, targetExcluded := range targetsExcluded {
-			if app.Name == targetExcluded {
+			if matchesTarget(app.Name, targetExcluded) {
 				app.Disable()
 				continue excludeAppsLoop
 			}
@@ -373,11 +442,16 @@ excludeAppsLoop:
 	if s.targetMap == nil {
 		s.targetMap = make(map[string]bool)
 	}
-	if len(targets) == 0 && len(groups) == 0 {
+	if len(targets) == 0 && len(groups) == 0 && len(selectors) == 0 {
 		return
 	}
+	var patterns []string
 	for _, t := range targets {
-		s.targetMap[t] = true
+		if isGlobPattern(t) {
+			patterns = append(patterns, t)
+		} else {
+			s.targetMap[t] = true
+		}
 	}
 	groupMap := make(map[string]struct{})
 	namespaces := make(map[string]struct{})
@@ -389,7 +463,14 @@ excludeAppsLoop:
 			namespaces[app.Namespace] = struct{}{}
 			continue
 		}
-		if _, ok := groupMap[app.Group]; ok {
+		_, selected := groupMap[app.Group]
+		for _, p := range patterns {
+			selected = selected || matchesTarget(app.Name, p)
+		}
+		for _, ls := range selectors {
+			selected = selected || ls.matches(app.Labels)
+		}
+		if selected {
 			s.targetMap[app.Name] = true
 			namespaces[app.Namespace] = struct{}{}
 		} else {
@@ -432,7 +513,7 @@ func (s *State) print() {
 	printMap(s.Certificates, 0)
 	fmt.Println("\nSettings: ")
 	fmt.Println("--------- ")
-	fmt.Printf("%+v\n", s.Settings)
+	fmt.Println(redactions.redact(fmt.Sprintf("%+v", s.Settings)))
 	fmt.Println("\nNamespaces: ")
 	fmt.Println("------------- ")
 	printNamespacesMap(s.Namespaces)
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+const appsSourcesKey = "appsSources"
+
+// export writes the effective desired state, after merging, defaulting and inheritance, to a file.
+// Secrets are redacted and, optionally, the DSF each app field came from is recorded under appsSources.
+func (s *State) export(file string, withSources bool) error {
+	m, err := s.toMap()
+	if err != nil {
+		return err
+	}
+	redactStateMap(m)
+	if withSources && len(s.appsSources) > 0 {
+		m[appsSourcesKey] = s.appsSources
+	}
+	return writeStateMap(file, m)
+}
+
+// redactStateMap replaces credentials, set values and sensitive setString values in a state map with a placeholder
+func redactStateMap(m map[string]interface{}) {
+	if settings, ok := m["settings"].(map[string]interface{}); ok {
+		for _, key := range []string{"password", "slackWebhook", "msTeamsWebhook"} {
+			if v, ok := settings[key].(string); ok && v != "" {
+				settings[key] = redactedValue
+			}
+		}
+	}
+	if repos, ok := m["helmRepos"].(map[string]interface{}); ok {
+		for name, v := range repos {
+			repo, _ := v.(string)
+			if u, err := url.Parse(repo); err == nil && u.User != nil {
+				if _, ok := u.User.Password(); ok {
+					// url.UserPassword would percent-encode the placeholder
+					u.User = url.User(u.User.Username())
+					user := u.User.String()
+					repos[name] = strings.Replace(u.String(), user+"@", user+":"+redactedValue+"@", 1)
+				}
+			}
+		}
+	}
+	for _, section := range []string{"namespaces", "namespaceTemplates"} {
+		namespaces, _ := m[section].(map[string]interface{})
+		for _, v := range namespaces {
+			ns, _ := v.(map[string]interface{})
+			secrets, _ := ns["imagePullSecrets"].(map[string]interface{})
+			for _, s := range secrets {
+				secret, _ := s.(map[string]interface{})
+				for _, key := range []string{"password", "dockerConfigJson"} {
+					if v, ok := secret[key].(string); ok && v != "" {
+						secret[key] = redactedValue
+					}
+				}
+			}
+		}
+	}
+	for _, section := range []string{"apps", "appsTemplates"} {
+		apps, _ := m[section].(map[string]interface{})
+		for _, v := range apps {
+			app, _ := v.(map[string]interface{})
+			set, _ := app["set"].(map[string]interface{})
+			for k := range set {
+				set[k] = redactedValue
+			}
+			setString, _ := app["setString"].(map[string]interface{})
+			sensitiveKeys, _ := app["sensitiveKeys"].([]interface{})
+			for _, k := range sensitiveKeys {
+				if key, ok := k.(string); ok && setString[key] != nil {
+					setString[key] = redactedValue
+				}
+			}
+		}
+	}
+}
+
+// recordAppSources records which desired state file set each field of the given apps
+func (s *State) recordAppSources(apps map[string]*Release, file string) {
+	if s.appsSources == nil {
+		s.appsSources = make(map[string]map[string][]string)
+	}
+	for appName, app := range apps {
+		if app == nil {
+			continue
+		}
+		if s.appsSources[appName] == nil {
+			s.appsSources[appName] = make(map[string][]string)
+		}
+		sources := s.appsSources[appName]
+		v := reflect.ValueOf(app).Elem()
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" || isZeroField(v.Field(i)) {
+				continue
+			}
+			switch field.Type.Kind() {
+			case reflect.Slice, reflect.Map:
+				// slices are appended and maps are merged across files, so every file contributes
+				if !stringInSlice(file, sources[name]) {
+					sources[name] = append(sources[name], file)
+				}
+			default:
+				sources[name] = []string{file}
+			}
+		}
+	}
+}
+
+// isZeroField checks if a struct field was left unset in a desired state file
+func isZeroField(v reflect.Value) bool {
+	if nb, ok := v.Interface().(NullBool); ok {
+		return !nb.HasValue
+	}
+	return v.IsZero()
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -24,14 +25,13 @@ func (s *State) fromFile(file string) error {
 	}
 }
 
-func (s *State) toFile(file string) {
-	if isOfType(file, []string{".toml"}) {
-		s.toTOML(file)
-	} else if isOfType(file, []string{".yaml", ".yml"}) {
-		s.toYAML(file)
-	} else {
-		log.Fatal("State file does not have toml/yaml extension.")
+// toFile encodes the state into a TOML, YAML or JSON file depending on the file extension
+func (s *State) toFile(file string) error {
+	m, err := s.toMap()
+	if err != nil {
+		return err
 	}
+	return writeStateMap(file, m)
 }
 
 // fromTOML reads a toml file and decodes it to a state type.
@@ -50,7 +50,9 @@ func (s *State) fromTOML(file string) error {
 		tomlFile = substituteEnv(tomlFile)
 	}
 	if !flags.noSSMSubst {
-		tomlFile = substituteSSM(tomlFile)
+		if tomlFile, err = secrets.substitute(tomlFile, file); err != nil {
+			return err
+		}
 	}
 	if _, err := toml.Decode(tomlFile, s); err != nil {
 		return err
@@ -59,20 +61,15 @@ func (s *State) fromTOML(file string) error {
 	return nil
 }
 
-// toTOML encodes a state type into a TOML file.
+// toTOML encodes a state map into TOML.
 // It uses the BurntSuchi TOML parser.
-func (s *State) toTOML(file string) {
-	log.Info("Printing generated toml ... ")
+func toTOML(m map[string]interface{}) ([]byte, error) {
 	var buff bytes.Buffer
 
-	if err := toml.NewEncoder(&buff).Encode(s); err != nil {
-		log.Fatal(err.Error())
-		os.Exit(1)
+	if err := toml.NewEncoder(&buff).Encode(m); err != nil {
+		return nil, err
 	}
-	if err := os.WriteFile(file, buff.Bytes(), 0o644); err != nil {
-		log.Fatal(err.Error())
-	}
-	log.Info(fmt.Sprintf("Wrote to %s.\n", file))
+	return buff.Bytes(), nil
 }
 
 // fromYAML reads a yaml file and decodes it to a state type.
@@ -91,7 +88,12 @@ func (s *State) fromYAML(file string) error {
 		yamlFile = substituteEnv(yamlFile)
 	}
 	if !flags.noSSMSubst {
-		yamlFile = substituteSSM(yamlFile)
+		if yamlFile, err = secrets.substitute(yamlFile, file); err != nil {
+			return err
+		}
+	}
+	if yamlFile, err = mergeAnchoredValues(yamlFile); err != nil {
+		return err
 	}
 
 	if err = yaml.Unmarshal([]byte(yamlFile), s); err != nil {
@@ -101,19 +103,80 @@ func (s *State) fromYAML(file string) error {
 	return nil
 }
 
-// toYaml encodes a state type into a YAML file
-func (s *State) toYAML(file string) {
-	log.Info("Printing generated yaml ... ")
+// toYAML encodes a state map into YAML
+func toYAML(m map[string]interface{}) ([]byte, error) {
+	return yaml.Marshal(m)
+}
+
+// toJSON encodes a state map into indented JSON
+func toJSON(m map[string]interface{}) ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
 
-	ymlBytes, err := yaml.Marshal(s)
+// toMap converts the state into a generic map keyed by the desired state file field names
+func (s *State) toMap() (map[string]interface{}, error) {
+	raw, err := json.Marshal(s)
 	if err != nil {
-		log.Fatal(err.Error())
-		os.Exit(1)
+		return nil, err
 	}
-	if err := os.WriteFile(file, ymlBytes, 0o644); err != nil {
-		log.Fatal(err.Error())
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
 	}
-	log.Info(fmt.Sprintf("Wrote to %s.\n", file))
+	return normalizeStateMap(m).(map[string]interface{}), nil
+}
+
+// normalizeStateMap drops null values and converts JSON numbers to int64 or float64
+// so that every encoder writes them back in their original form
+func normalizeStateMap(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if item == nil {
+				delete(val, k)
+				continue
+			}
+			val[k] = normalizeStateMap(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = normalizeStateMap(item)
+		}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	}
+	return v
+}
+
+// writeStateMap writes a state map to a TOML, YAML or JSON file depending on the file extension
+func writeStateMap(file string, m map[string]interface{}) error {
+	var encode func(map[string]interface{}) ([]byte, error)
+	switch {
+	case isOfType(file, []string{".toml", ".tml"}):
+		encode = toTOML
+	case isOfType(file, []string{".yaml", ".yml"}):
+		encode = toYAML
+	case isOfType(file, []string{".json"}):
+		encode = toJSON
+	default:
+		return fmt.Errorf("state file %s does not have a toml/yaml/json extension", file)
+	}
+
+	data, err := encode(m)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("Wrote to %s.", file))
+	return nil
 }
 
 func (s *State) build(files fileOptionArray) error {
@@ -138,14 +201,12 @@ func (s *State) build(files fileOptionArray) error {
 			}
 		}
 		fileState.expand(f.name)
+		s.recordAppSources(fileState.Apps, f.name)
 
 		// Merge Apps that already existed in the state
 		for appName, app := range fileState.Apps {
-			if _, ok := s.Apps[appName]; ok {
-				if err := mergo.Merge(s.Apps[appName], app,
-					mergo.WithAppendSlice,
-					mergo.WithOverride,
-					mergo.WithTransformers(MergoTransformer(NullBoolTransformer))); err != nil {
+			if existing, ok := s.Apps[appName]; ok {
+				if err := mergeRelease(existing, app); err != nil {
 					return fmt.Errorf("failed to merge %s from desired state file %s: %w", appName, f.name, err)
 				}
 			}
@@ -163,8 +224,21 @@ func (s *State) build(files fileOptionArray) error {
 		}
 	}
 
-	s.init() // Set defaults
-	return nil
+	if flags.cluster != "" {
+		if err := s.applyCluster(flags.cluster); err != nil {
+			return err
+		}
+	}
+
+	if err := s.resolveTemplates(); err != nil {
+		return err
+	}
+
+	if err := s.resolveNamespaceTemplates(); err != nil {
+		return err
+	}
+
+	return s.init() // Set defaults
 }
 
 // expand resolves relative paths of certs/keys/chart/value file/secret files/etc and replace them with a absolute paths
@@ -176,7 +250,24 @@ func (s *State) expand(relativeToFile string) {
 	if checkHelmVersion(">=3.8.0") {
 		validProtocols = append(validProtocols, "oci")
 	}
+	releases := make([]*Release, 0, len(s.Apps)+len(s.AppsTemplates))
 	for _, r := range s.Apps {
+		releases = append(releases, r)
+	}
+	// templates and cluster overrides are expanded as well since apps can inherit their files from them
+	for _, r := range s.AppsTemplates {
+		if r != nil {
+			releases = append(releases, r)
+		}
+	}
+	for _, c := range s.Clusters {
+		for _, r := range c.Apps {
+			if r != nil {
+				releases = append(releases, r)
+			}
+		}
+	}
+	for _, r := range releases {
 		// resolve paths for all release files (values, secrets, hooks, etc...)
 		r.resolvePaths(dir, downloadDest)
 
@@ -200,6 +291,31 @@ func (s *State) expand(relativeToFile string) {
 		// expand env variables for all release files
 		r.substituteVarsInStaticFiles()
 	}
+	// resolve paths and expand env variables for the files of the namespaces defaults, the image pull secrets files and the manifests,
+	// templates are resolved as well since namespaces can inherit their files from them
+	namespaces := make([]*Namespace, 0, len(s.Namespaces)+len(s.NamespaceTemplates))
+	for _, ns := range s.Namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	for _, ns := range s.NamespaceTemplates {
+		namespaces = append(namespaces, ns)
+	}
+	for _, ns := range namespaces {
+		if ns == nil {
+			continue
+		}
+		if ns.Defaults != nil {
+			ns.Defaults.resolvePaths(dir, downloadDest)
+		}
+		for _, ips := range ns.ImagePullSecrets {
+			if ips != nil && ips.File != "" {
+				ips.File, _ = resolveOnePath(ips.File, dir, downloadDest)
+			}
+		}
+		if len(ns.Manifests) > 0 {
+			ns.Manifests = resolveManifestPaths(ns.Manifests, dir, downloadDest)
+		}
+	}
 	// resolve paths and expand env variables for global hook files
 	for key, val := range s.Settings.GlobalHooks {
 		if key != "deleteOnSuccess" && key != "successTimeout" && key != "successCondition" {
@@ -235,8 +351,8 @@ func (s *State) isChartFromRepo(chart string) bool {
 }
 
 // cleanup deletes the k8s certificates and keys files
-// It also deletes any Tiller TLS certs and keys
-// and secret files
+// It also deletes any Tiller TLS certs and keys.
+// Decrypted secrets are always deleted by decrypted.remove, regardless of --no-cleanup
 func (s *State) cleanup() {
 	log.Verbose("Cleaning up sensitive and temp files")
 	if _, err := os.Stat("ca.crt"); err == nil {
@@ -254,15 +370,4 @@ func (s *State) cleanup() {
 	if _, err := os.Stat("bearer.token"); err == nil {
 		deleteFile("bearer.token")
 	}
-
-	for _, app := range s.Apps {
-		if _, err := os.Stat(app.SecretsFile + ".dec"); err == nil {
-			deleteFile(app.SecretsFile + ".dec")
-		}
-		for _, secret := range app.SecretsFiles {
-			if _, err := os.Stat(secret + ".dec"); err == nil {
-				deleteFile(secret + ".dec")
-			}
-		}
-	}
 }
@@ -2,6 +2,7 @@ package app
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -404,3 +405,38 @@ func Test_DSFMergeWithOverwrite(t *testing.T) {
 		t.Errorf("build() - unexpected status of a release, wanted 'enabled'=false got %v", s.Apps["jenkins"].Enabled.Value)
 	}
 }
+
+func Test_build_mergesValuesAcrossFiles(t *testing.T) {
+	teardownTestCase, err := setupStateFileTestCase(t)
+	if err != nil {
+		t.Errorf("setupStateFileTestCase(), got: %v", err)
+	}
+	defer teardownTestCase(t)
+
+	dir := t.TempDir()
+	app := "apps:\n  app:\n    namespace: default\n    chart: repo/app\n    version: 1.0.0\n    values:\n      list: [b]\n"
+	files := []struct{ name, content string }{
+		{"base.yaml", "helmRepos:\n  repo: https://example.com/charts\n" + app + "      image:\n        tag: v1\n"},
+		{"override.yaml", app + "      image:\n        pullPolicy: Always\n"},
+	}
+	var fileOptions fileOptionArray
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fileOptions = append(fileOptions, fileOption{name: path})
+	}
+
+	s := new(State)
+	if err := s.build(fileOptions); err != nil {
+		t.Fatalf("build() - unexpected error: %v", err)
+	}
+	want := map[string]interface{}{
+		"list":  []interface{}{"b"},
+		"image": map[string]interface{}{"tag": "v1", "pullPolicy": "Always"},
+	}
+	if got := s.Apps["app"].Values; !reflect.DeepEqual(got, want) {
+		t.Errorf("build() - merged values = %v, want %v", got, want)
+	}
+}
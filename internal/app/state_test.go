@@ -57,7 +57,7 @@ func Test_state_validate(t *testing.T) {
 					ClusterURI:  "https://192.168.99.100:8443",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -81,7 +81,7 @@ func Test_state_validate(t *testing.T) {
 					ClusterURI:  "https://192.168.99.100:8443",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -102,7 +102,7 @@ func Test_state_validate(t *testing.T) {
 					KubeContext: "minikube",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -126,7 +126,7 @@ func Test_state_validate(t *testing.T) {
 					ClusterURI:  "https://192.168.99.100:8443",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -150,7 +150,7 @@ func Test_state_validate(t *testing.T) {
 					ClusterURI:  "$URI", // unset env
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -174,7 +174,7 @@ func Test_state_validate(t *testing.T) {
 					ClusterURI:  "https//192.168.99.100:8443", // invalid url
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -197,7 +197,7 @@ func Test_state_validate(t *testing.T) {
 					ClusterURI:  "https://192.168.99.100:8443",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -218,7 +218,7 @@ func Test_state_validate(t *testing.T) {
 					ClusterURI:  "https://192.168.99.100:8443",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -242,7 +242,7 @@ func Test_state_validate(t *testing.T) {
 					ClusterURI:  "https://192.168.99.100:8443",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -260,7 +260,7 @@ func Test_state_validate(t *testing.T) {
 					KubeContext: "minikube",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -310,7 +310,7 @@ func Test_state_validate(t *testing.T) {
 					KubeContext: "minikube",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: nil,
 				Apps:      make(map[string]*Release),
@@ -325,7 +325,7 @@ func Test_state_validate(t *testing.T) {
 					KubeContext: "minikube",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{},
 				Apps:      make(map[string]*Release),
@@ -340,7 +340,7 @@ func Test_state_validate(t *testing.T) {
 					KubeContext: "minikube",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -358,7 +358,7 @@ func Test_state_validate(t *testing.T) {
 					KubeContext: "minikube",
 				},
 				Namespaces: map[string]*Namespace{
-					"staging": {false, Limits{}, make(map[string]string), make(map[string]string), &Quotas{}, false},
+					"staging": {Limits: Limits{}, Labels: make(map[string]string), Annotations: make(map[string]string), Quotas: &Quotas{}},
 				},
 				HelmRepos: map[string]string{
 					"deprecated-stable": "https://kubernetes-charts.storage.googleapis.com",
@@ -509,7 +509,7 @@ func Test_state_getReleaseChartsInfo(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			stt := &State{Apps: tt.args.apps}
-			stt.disableApps(tt.groupFlag, tt.targetFlag, []string{}, []string{})
+			stt.disableApps(tt.groupFlag, tt.targetFlag, []string{}, []string{}, nil)
 			err := stt.getReleaseChartsInfo()
 			switch err.(type) {
 			case nil:
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dario.cat/mergo"
+)
+
+// resolveTemplates applies the appsTemplates referenced with the template field to the apps.
+// Templates are applied in the order they are listed and the app's own settings are applied last.
+// Maps are deep merged and slices are appended.
+func (s *State) resolveTemplates() error {
+	resolved := make(map[string]*Release)
+	names := make([]string, 0, len(s.Apps))
+	for name := range s.Apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		r := s.Apps[name]
+		if r == nil || len(r.Template) == 0 {
+			continue
+		}
+		base, err := s.templatesBase(r.Template, resolved, nil)
+		if err != nil {
+			return fmt.Errorf("app [ %s ]: %w", name, err)
+		}
+		if err := mergeRelease(base, r); err != nil {
+			return fmt.Errorf("app [ %s ]: failed to apply templates: %w", name, err)
+		}
+		// the release name and templates are never inherited
+		base.Name = r.Name
+		base.Template = r.Template
+		*r = *base
+	}
+	return nil
+}
+
+// templatesBase merges the given templates, in order, into a new release
+func (s *State) templatesBase(names []string, resolved map[string]*Release, chain []string) (*Release, error) {
+	base := &Release{}
+	for _, name := range names {
+		tpl, err := s.getTemplate(name, resolved, chain)
+		if err != nil {
+			return nil, err
+		}
+		if err := mergeRelease(base, tpl.clone()); err != nil {
+			return nil, fmt.Errorf("failed to apply template [ %s ]: %w", name, err)
+		}
+	}
+	return base, nil
+}
+
+// getTemplate returns an appsTemplate with the templates it inherits from applied
+func (s *State) getTemplate(name string, resolved map[string]*Release, chain []string) (*Release, error) {
+	if tpl, ok := resolved[name]; ok {
+		return tpl, nil
+	}
+	if stringInSlice(name, chain) {
+		return nil, fmt.Errorf("appsTemplates have a cycle: %s", strings.Join(append(chain, name), " -> "))
+	}
+	tpl, ok := s.AppsTemplates[name]
+	if !ok || tpl == nil {
+		return nil, fmt.Errorf("template [ %s ] is not defined in appsTemplates", name)
+	}
+
+	result := tpl.clone()
+	if len(tpl.Template) > 0 {
+		base, err := s.templatesBase(tpl.Template, resolved, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+		if err := mergeRelease(base, result); err != nil {
+			return nil, fmt.Errorf("failed to apply templates to template [ %s ]: %w", name, err)
+		}
+		result = base
+	}
+	resolved[name] = result
+	return result, nil
+}
+
+// mergeRelease merges src into dst, slices are appended and inline values are deep merged.
+// mergo replaces nested maps and appends the lists of values to themselves, so values are merged separately.
+func mergeRelease(dst, src *Release) error {
+	var values map[string]interface{}
+	if len(dst.Values) > 0 || len(src.Values) > 0 {
+		values = mergeValues(copyValues(dst.Values), copyValues(src.Values))
+	}
+	withoutValues := *src
+	withoutValues.Values = nil
+	dst.Values = nil
+	if err := mergo.Merge(dst, &withoutValues,
+		mergo.WithAppendSlice,
+		mergo.WithOverride,
+		mergo.WithTransformers(MergoTransformer(NullBoolTransformer))); err != nil {
+		return err
+	}
+	dst.Values = values
+	return nil
+}
+
+// clone returns a copy of the release that does not share maps or slices with it
+func (r *Release) clone() *Release {
+	c := *r
+	c.Template = append(StringList(nil), r.Template...)
+	c.Namespaces = append([]string(nil), r.Namespaces...)
+	c.ValuesFiles = append([]string(nil), r.ValuesFiles...)
+	c.SecretsFiles = append([]string(nil), r.SecretsFiles...)
+	c.HelmFlags = append([]string(nil), r.HelmFlags...)
+	c.HelmDiffFlags = append([]string(nil), r.HelmDiffFlags...)
+	c.Labels = copyStringMap(r.Labels)
+	c.Set = copyStringMap(r.Set)
+	c.SetString = copyStringMap(r.SetString)
+	c.SetFile = copyStringMap(r.SetFile)
+	c.SensitiveKeys = append([]string(nil), r.SensitiveKeys...)
+	if r.Hooks != nil {
+		c.Hooks = copyValues(r.Hooks)
+	}
+	if r.Values != nil {
+		c.Values = copyValues(r.Values)
+	}
+	return &c
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_state_resolveTemplates(t *testing.T) {
+	s := &State{
+		AppsTemplates: map[string]*Release{
+			"base": {
+				Wait:      True,
+				Timeout:   600,
+				HelmFlags: []string{"--atomic"},
+				Hooks:     map[string]interface{}{"successTimeout": "90s"},
+				Values:    map[string]interface{}{"image": map[string]interface{}{"pullPolicy": "Always", "tag": "latest"}},
+			},
+			"monitored": {
+				Template: StringList{"base"},
+				Set:      map[string]string{"metrics.enabled": "true"},
+			},
+		},
+		Apps: map[string]*Release{
+			"app": {
+				Template:  StringList{"monitored"},
+				Namespace: "default",
+				Timeout:   900,
+				HelmFlags: []string{"--force"},
+				Values:    map[string]interface{}{"image": map[string]interface{}{"tag": "v1"}},
+			},
+			"plain": {Namespace: "default"},
+		},
+	}
+	if err := s.resolveTemplates(); err != nil {
+		t.Fatalf("resolveTemplates() unexpected error: %v", err)
+	}
+
+	want := &Release{
+		Template:  StringList{"monitored"},
+		Namespace: "default",
+		Wait:      True,
+		Timeout:   900,
+		HelmFlags: []string{"--atomic", "--force"},
+		Set:       map[string]string{"metrics.enabled": "true"},
+		Hooks:     map[string]interface{}{"successTimeout": "90s"},
+		Values:    map[string]interface{}{"image": map[string]interface{}{"pullPolicy": "Always", "tag": "v1"}},
+	}
+	if got := s.Apps["app"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveTemplates() = %+v, want %+v", got, want)
+	}
+	if got := s.Apps["plain"]; !reflect.DeepEqual(got, &Release{Namespace: "default"}) {
+		t.Errorf("resolveTemplates() changed an app without templates: %+v", got)
+	}
+	if got := s.AppsTemplates["base"].Values["image"].(map[string]interface{})["tag"]; got != "latest" {
+		t.Errorf("resolveTemplates() modified the template values, got tag %v", got)
+	}
+}
+
+func Test_state_resolveTemplates_errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]*Release
+		wantErr   string
+	}{
+		{
+			name:      "missing template",
+			templates: map[string]*Release{},
+			wantErr:   "template [ a ] is not defined",
+		}, {
+			name: "cycle",
+			templates: map[string]*Release{
+				"a": {Template: StringList{"b"}},
+				"b": {Template: StringList{"a"}},
+			},
+			wantErr: "a -> b -> a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &State{
+				AppsTemplates: tt.templates,
+				Apps:          map[string]*Release{"app": {Template: StringList{"a"}}},
+			}
+			err := s.resolveTemplates()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolveTemplates() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_build_resolvesTemplatesAcrossFiles(t *testing.T) {
+	teardownTestCase, err := setupStateFileTestCase(t)
+	if err != nil {
+		t.Errorf("setupStateFileTestCase(), got: %v", err)
+	}
+	defer teardownTestCase(t)
+
+	dir := t.TempDir()
+	files := []struct{ name, content string }{
+		{"templates.toml", "[helmRepos]\nrepo = \"https://example.com/charts\"\n[appsTemplates.base]\nwait = true\ntimeout = 600\nhelmFlags = [\"--atomic\"]\n"},
+		{"apps.yaml", "apps:\n  app:\n    template: base\n    namespace: default\n    chart: repo/app\n    version: 1.0.0\n"},
+	}
+	var fileOptions fileOptionArray
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fileOptions = append(fileOptions, fileOption{name: path})
+	}
+
+	s := new(State)
+	if err := s.build(fileOptions); err != nil {
+		t.Fatalf("build() - unexpected error: %v", err)
+	}
+	app := s.Apps["app"]
+	if !app.Wait.Value || app.Timeout != 600 || !reflect.DeepEqual(app.HelmFlags, []string{"--atomic"}) {
+		t.Errorf("build() - app did not inherit its template: %+v", app)
+	}
+}
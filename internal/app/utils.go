@@ -1,7 +1,6 @@
 package app
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
@@ -25,16 +24,12 @@ import (
 	"github.com/Praqma/helmsman/internal/gcs"
 )
 
-var (
-	comment  = regexp.MustCompile("#(.*)$")
-	envVar   = regexp.MustCompile(`\${([a-zA-Z_][a-zA-Z0-9_-]*)}|\$([a-zA-Z_][a-zA-Z0-9_-]*)`)
-	ssmParam = regexp.MustCompile(`{{ssm: ([^~}]+)(~(true))?}}`)
-)
+var envVar = regexp.MustCompile(`\${([a-zA-Z_][a-zA-Z0-9_-]*)}|\$([a-zA-Z_][a-zA-Z0-9_-]*)`)
 
 // printMap prints to the console any map of string keys and values.
 func printMap(m map[string]string, indent int) {
 	for key, value := range m {
-		fmt.Println(strings.Repeat("\t", indent)+key, ": ", value)
+		fmt.Println(strings.Repeat("\t", indent)+key, ": ", redactions.redact(value))
 	}
 }
 
@@ -54,16 +49,7 @@ func substituteVarsInYaml(file string) string {
 		log.Fatal(err.Error())
 	}
 
-	yamlFile := string(rawYamlFile)
-	if !flags.noEnvSubst && flags.substEnvValues {
-		if err := validateEnvVars(yamlFile, file); err != nil {
-			log.Fatal(err.Error())
-		}
-		yamlFile = substituteEnv(yamlFile)
-	}
-	if !flags.noSSMSubst && flags.substSSMValues {
-		yamlFile = substituteSSM(yamlFile)
-	}
+	yamlFile := substituteVars(string(rawYamlFile), file)
 
 	dir := createTempDir(tempFilesDir, "tmp")
 
@@ -76,6 +62,24 @@ func substituteVarsInYaml(file string) string {
 	return outFile
 }
 
+// substituteVars substitutes the env variables and the secret references of the content of a file,
+// when enabled with --subst-env-values and --subst-ssm-values
+func substituteVars(content, file string) string {
+	var err error
+	if !flags.noEnvSubst && flags.substEnvValues {
+		if err := validateEnvVars(content, file); err != nil {
+			log.Fatal(err.Error())
+		}
+		content = substituteEnv(content)
+	}
+	if !flags.noSSMSubst && flags.substSSMValues {
+		if content, err = secrets.substitute(content, file); err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	return content
+}
+
 // func stringInSlice checks if a string is in a slice
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
@@ -175,66 +179,30 @@ func prepareEnv(envFiles []string) error {
 	return nil
 }
 
-// substituteEnv checks if a string has an env variable (contains '$'), then it returns its value
+// substituteEnv checks if a string has an env variable (contains '$'), then it returns its value.
+// It supports the ${VAR:-default}, ${VAR:?message} and ${VAR:+alt} shell syntax and $$ escapes a literal $.
 // if the env variable is empty or unset, an empty string is returned
 // if the string does not contain '$', it is returned as is.
 func substituteEnv(str string) string {
-	if strings.Contains(str, "$") {
-		// add $$ escaping for $ strings
-		os.Setenv("HELMSMAN_DOLLAR", "$")
-		return os.Expand(strings.ReplaceAll(str, "$$", "${HELMSMAN_DOLLAR}"), getEnv)
-	}
-	return str
+	e := &envExpander{}
+	return e.expand(str)
 }
 
 // validateEnvVars parses a string line-by-line and detect env variables in
 // non-comment lines. It then checks that each env var found has a value.
+// Required variables, ${VAR:?message}, are checked even when validation is skipped.
+// All the missing variables are reported at once.
 func validateEnvVars(s string, filename string) error {
-	if !flags.skipValidation && strings.Contains(s, "$") {
+	if !strings.Contains(s, "$") {
+		return nil
+	}
+	if !flags.skipValidation {
 		log.Info("validating environment variables in " + filename)
-		var key string
-		scanner := bufio.NewScanner(strings.NewReader(s))
-		for scanner.Scan() {
-			// remove spaces from the single line, then replace $$ with !? to prevent it from matching the regex,
-			// then remove new line and inline comments from the text
-			text := comment.ReplaceAllString(strings.ReplaceAll(strings.TrimSpace(scanner.Text()), "$$", "!?"), "")
-			for _, v := range envVar.FindAllStringSubmatch(text, -1) {
-				// FindAllStringSubmatch may match the first (${MY_VAR}) or the second ($MY_VAR) group from the regex
-				if v[1] != "" {
-					key = v[1]
-				} else {
-					key = v[2]
-				}
-				if _, ok := os.LookupEnv(key); !ok {
-					return fmt.Errorf("%s is used as an env variable but is currently unset. Either set it or escape it like so: $%s", v[0], v[0])
-				}
-			}
-		}
-		if err := scanner.Err(); err != nil {
-			log.Fatal(err.Error())
-		}
 	}
-	return nil
-}
-
-// substituteSSM checks if a string has an SSM parameter variable (contains '{{ssm: '), then it returns its value
-// if the env variable is empty or unset, an empty string is returned
-// if the string does not contain '$', it is returned as is.
-func substituteSSM(name string) string {
-	if strings.Contains(name, "{{ssm: ") {
-		matches := ssmParam.FindAllSubmatch([]byte(name), -1)
-		for _, match := range matches {
-			placeholder := string(match[0])
-			paramPath := string(match[1])
-			withDecryption, err := strconv.ParseBool(string(match[3]))
-			if err != nil {
-				fmt.Printf("Invalid decryption argument %T \n", string(match[3]))
-			}
-			value := aws.ReadSSMParam(paramPath, withDecryption, flags.noColors)
-			name = strings.ReplaceAll(name, placeholder, value)
-		}
+	if errs := envVarErrors(s, filename, !flags.skipValidation); len(errs) > 0 {
+		return fmt.Errorf("missing environment variables:\n%s", strings.Join(errs, "\n"))
 	}
-	return name
+	return nil
 }
 
 // replaceAtIndex replaces the charecter at the given index in the string with the given rune
@@ -349,6 +317,7 @@ func deleteFile(path string) {
 // It returns true if the sending of the message is successful, otherwise returns false
 func notifySlack(content string, url string, failure bool, executing bool) bool {
 	log.Info("Posting notifications to Slack ... ")
+	content = redactions.redact(content)
 
 	color := "#36a64f" // green
 	if failure {
@@ -475,17 +444,26 @@ func writeStringToFile(filename string, data string) error {
 	return file.Sync()
 }
 
-// decrypt a eyaml or helm secret file
-func decryptSecret(name string) error {
+// decrypt a secret file with the configured secrets backend, natively for SOPS or with eyaml or a helm plugin.
+// It returns the decrypted file, which is written to a private temp directory and never next to the secret file.
+func decryptSecret(name string) (string, error) {
+	if file, ok := decrypted.lookup(name); ok {
+		return file, nil
+	}
+	backend := settings.getSecretsBackend()
+	if backend == secretsBackendSOPS {
+		return decryptSOPS(name)
+	}
+
 	cmd := helmBin
 	args := []string{"secrets", "dec", name}
 	// helm-secrets >=4.0.0 decrypts to stdout, not to a .dec-file
-	useHelmOutput := checkHelmPlugVersion("secrets", ">=4.0.0-0") || settings.EyamlEnabled
+	useHelmOutput := backend == secretsBackendEyaml || checkHelmPlugVersion("secrets", ">=4.0.0-0")
 	if useHelmOutput {
 		args[1] = "decrypt"
 	}
 
-	if settings.EyamlEnabled {
+	if backend == secretsBackendEyaml {
 		cmd = "eyaml"
 		args = []string{"decrypt", "-f", name}
 		if settings.EyamlGkms {
@@ -495,7 +473,7 @@ func decryptSecret(name string) error {
 		} else if settings.EyamlPrivateKeyPath != "" && settings.EyamlPublicKeyPath != "" {
 			args = append(args, []string{"--pkcs7-private-key", settings.EyamlPrivateKeyPath, "--pkcs7-public-key", settings.EyamlPublicKeyPath}...)
 		}
-	} else if settings.VaultEnabled {
+	} else if backend == secretsBackendHelmVault {
 		args = []string{"vault", "dec"}
 		if settings.VaultDeliminator != "" {
 			args = append(args, []string{"--deliminator", settings.VaultDeliminator}...)
@@ -526,38 +504,28 @@ func decryptSecret(name string) error {
 
 	res, err := command.Exec()
 	if err != nil {
-		return err
-	}
-
-	outfile := name
-	if !isOfType(name, []string{".dec"}) {
-		outfile += ".dec"
+		return "", err
 	}
 
-	if settings.VaultEnabled {
-		// helm-vault plugin doesn't write to stdout
-		useHelmOutput = false
-		if settings.VaultEnvironment != "" {
-			// helm-vault decryption with an environment interpolate the environment name into the output filename
-			vaultOutFile := name + "." + settings.VaultEnvironment + ".dec"
-			if _, err := os.Stat(vaultOutFile); err != nil {
-				return fmt.Errorf("decrypted vault file not found: %s", vaultOutFile)
-			}
-			os.Rename(vaultOutFile, outfile)
+	if useHelmOutput && backend != secretsBackendHelmVault {
+		file, err := decrypted.write(name, res.output)
+		if err != nil {
+			return "", fmt.Errorf("can't write the decrypted [ %s ] file: %w", name, err)
 		}
+		return file, nil
 	}
 
-	if !useHelmOutput {
-		if _, err := os.Stat(outfile); err != nil {
-			return fmt.Errorf("decryption failed: %s", res.String())
-		}
-		return nil
+	// helm-vault and helm-secrets <4.0.0 write the decrypted file next to the secrets file,
+	// it's moved to the private directory right away
+	outfile := name + ".dec"
+	if backend == secretsBackendHelmVault && settings.VaultEnvironment != "" {
+		// helm-vault decryption with an environment interpolate the environment name into the output filename
+		outfile = name + "." + settings.VaultEnvironment + ".dec"
 	}
-
-	if err := writeStringToFile(outfile, res.output); err != nil {
-		return fmt.Errorf("can't write [ %s ] file: %w", outfile, err)
+	if _, err := os.Stat(outfile); err != nil {
+		return "", fmt.Errorf("decryption failed: %s", res.String())
 	}
-	return nil
+	return decrypted.move(name, outfile)
 }
 
 // isLocalChart checks if a chart specified in the DSF is a local directory or not
@@ -620,6 +588,7 @@ func checkVersion(version, constraint string) bool {
 // This implementation is inspired from Slack notification
 func notifyMSTeams(content string, url string, failure bool, executing bool) bool {
 	log.Info("Posting notifications to MS Teams ... ")
+	content = redactions.redact(content)
 
 	color := "#36a64f" // green
 	if failure {
@@ -267,7 +267,8 @@ func Test_eyamlSecrets(t *testing.T) {
 			settings.EyamlEnabled = tt.args.s.EyamlEnabled
 			settings.EyamlPublicKeyPath = tt.args.s.EyamlPublicKeyPath
 			settings.EyamlPrivateKeyPath = tt.args.s.EyamlPrivateKeyPath
-			err := decryptSecret(tt.args.r.SecretsFile)
+			defer decrypted.remove()
+			_, err := decryptSecret(tt.args.r.SecretsFile)
 			switch err.(type) {
 			case nil:
 				if tt.want != true {
@@ -278,9 +279,6 @@ func Test_eyamlSecrets(t *testing.T) {
 					t.Errorf("decryptSecret() = %v, want nil", err)
 				}
 			}
-			if _, err := os.Stat(tt.args.r.SecretsFile + ".dec"); err == nil {
-				defer deleteFile(tt.args.r.SecretsFile + ".dec")
-			}
 		})
 	}
 }
@@ -1,6 +1,7 @@
 package aws
 
 import (
+	"fmt"
 	"log"
 	"os"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/logrusorgru/aurora"
 )
@@ -64,30 +66,66 @@ func ReadFile(bucketName string, filename string, outFile string, noColors bool)
 	log.Println("Successfully downloaded " + filename + " from S3 as " + outFile)
 }
 
-// ReadSSMParam reads a value from an SSM Parameter
-func ReadSSMParam(keyname string, withDecryption bool, noColors bool) string {
-	style = aurora.NewAurora(!noColors)
+// endpointConfig returns the AWS config for a service, using the endpoint set with
+// AWS_ENDPOINT_URL_<SERVICE> or AWS_ENDPOINT_URL when there is one, e.g. to use a local fake
+func endpointConfig(service string) *aws.Config {
+	config := aws.NewConfig()
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL_" + service); endpoint != "" {
+		return config.WithEndpoint(endpoint)
+	}
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		return config.WithEndpoint(endpoint)
+	}
+	return config
+}
 
+// newSession creates an AWS session with the config (credentials + region) from env vars or aws profile
+func newSession() (*session.Session, error) {
 	// Checking env vars are set to configure AWS
 	if !checkCredentialsEnvVar() {
 		log.Println("WARN: Failed to find the AWS env vars needed to configure AWS. Please make sure they are set in the environment.")
 	}
-
-	// Create Session -- use config (credentials + region) from env vars or aws profile
 	sess, err := session.NewSession()
 	if err != nil {
-		log.Fatal(style.Bold(style.Red("ERROR: Can't create AWS session: " + err.Error())))
+		return nil, fmt.Errorf("can't create AWS session: %w", err)
 	}
+	return sess, nil
+}
 
-	ssmsvc := ssm.New(sess, aws.NewConfig())
+// GetSSMParam reads a value from an SSM Parameter
+func GetSSMParam(keyname string, withDecryption bool) (string, error) {
+	sess, err := newSession()
+	if err != nil {
+		return "", err
+	}
+
+	ssmsvc := ssm.New(sess, endpointConfig("SSM"))
 	param, err := ssmsvc.GetParameter(&ssm.GetParameterInput{
 		Name:           &keyname,
 		WithDecryption: &withDecryption,
 	})
 	if err != nil {
-		log.Fatal(style.Bold(style.Red("ERROR: Can't find the SSM Parameter " + keyname + " : " + err.Error())))
+		return "", fmt.Errorf("can't find the SSM Parameter %s: %w", keyname, err)
+	}
+	return aws.StringValue(param.Parameter.Value), nil
+}
+
+// GetSecret reads the value of a secret from Secrets Manager
+func GetSecret(secretID string) (string, error) {
+	sess, err := newSession()
+	if err != nil {
+		return "", err
 	}
 
-	value := *param.Parameter.Value
-	return value
+	smsvc := secretsmanager.New(sess, endpointConfig("SECRETS_MANAGER"))
+	secret, err := smsvc.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: &secretID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("can't find the secret %s in Secrets Manager: %w", secretID, err)
+	}
+	if secret.SecretString != nil {
+		return *secret.SecretString, nil
+	}
+	return string(secret.SecretBinary), nil
 }